@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// Affected returns the packages affected by changes between two versions of
+// the source.
+//
+// A package is affected if it contains a changed file, or if it imports an
+// affected package, directly or indirectly. A package whose tests import an
+// affected package is affected too, but that doesn't spread to its importers.
+// Changes to go.mod or go.sum affect every package.
+func (g *Go) Affected(
+	ctx context.Context,
+	// The version of the source to compare against, e.g. the merge base of a
+	// pull request.
+	base *dagger.Directory,
+	// The current version of the source.
+	src *dagger.Directory,
+	// Subdirectory containing the Go module.
+	// +optional
+	subdir string,
+) ([]string, error) {
+	lines, err := diffNameStatus(ctx, stageDrift(base, src))
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, line := range lines {
+		// e.g. "M\tfoo.go" or "R100\told.go\tnew.go"
+		changed = append(changed, strings.Split(line, "\t")[1:]...)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	goList := []string{"go", "list"}
+	if subdir != "" {
+		goList = append(goList, "-C", subdir)
+	}
+	goList = append(goList, "-json=ImportPath,Dir,Imports,TestImports,XTestImports", "./...")
+
+	out, err := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		With(Cd("/src", src)).
+		WithExec(goList).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs, err := parseGoList(strings.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	return affectedPackages(pkgs, subdir, changed), nil
+}
+
+// TestAffected runs tests for only the packages affected by changes between
+// two versions of the source. See Affected for details.
+func (g *Go) TestAffected(
+	ctx context.Context,
+	// The version of the source to compare against, e.g. the merge base of a
+	// pull request.
+	base *dagger.Directory,
+	// The current version of the source.
+	src *dagger.Directory,
+	// Subdirectory in which to run the tests, i.e. go run -C.
+	// +optional
+	subdir string,
+	// Run with -v.
+	// +optional
+	verbose bool,
+	// Whether to run tests with race detection.
+	// +optional
+	race bool,
+	// Arbitrary flags to pass along to go test.
+	// +optional
+	testFlags []string,
+	// Whether to run tests insecurely, i.e. with special privileges.
+	// +optional
+	insecureRootCapabilities bool,
+	// Enable experimental Dagger nesting.
+	// +optional
+	nest bool,
+	// Collect a coverage profile across the affected packages.
+	// +optional
+	coverage bool,
+) (*TestResult, error) {
+	pkgs, err := g.Affected(ctx, base, src, subdir)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return &TestResult{
+			Report: dag.Directory().WithNewFile("test.json", "").File("test.json"),
+		}, nil
+	}
+	return g.runTests(ctx, testOpts{
+		Src:                      src,
+		Subdir:                   subdir,
+		Packages:                 pkgs,
+		Verbose:                  verbose,
+		Race:                     race,
+		TestFlags:                testFlags,
+		InsecureRootCapabilities: insecureRootCapabilities,
+		Nest:                     nest,
+		Coverage:                 coverage,
+	})
+}
+
+// goListPackage is the subset of go list -json output used to build the
+// import graph.
+type goListPackage struct {
+	ImportPath   string
+	Dir          string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+}
+
+// parseGoList decodes a stream of go list -json packages.
+func parseGoList(r io.Reader) ([]*goListPackage, error) {
+	var pkgs []*goListPackage
+	dec := json.NewDecoder(r)
+	for {
+		var pkg goListPackage
+		if err := dec.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, &pkg)
+	}
+	return pkgs, nil
+}
+
+// affectedPackages walks the import graph in reverse from the packages
+// containing the changed files, which are relative to the source root.
+func affectedPackages(pkgs []*goListPackage, subdir string, changed []string) []string {
+	byDir := map[string]*goListPackage{}
+	importers := map[string][]string{}
+	testImporters := map[string][]string{}
+	for _, pkg := range pkgs {
+		dir := strings.TrimPrefix(strings.TrimPrefix(pkg.Dir, "/src"), "/")
+		if dir == "" {
+			dir = "."
+		}
+		byDir[dir] = pkg
+		for _, imp := range pkg.Imports {
+			importers[imp] = append(importers[imp], pkg.ImportPath)
+		}
+		for _, imports := range [][]string{pkg.TestImports, pkg.XTestImports} {
+			for _, imp := range imports {
+				testImporters[imp] = append(testImporters[imp], pkg.ImportPath)
+			}
+		}
+	}
+
+	affected := map[string]bool{}
+	var queue []string
+	mark := func(importPath string) {
+		if !affected[importPath] {
+			affected[importPath] = true
+			queue = append(queue, importPath)
+		}
+	}
+
+	for _, file := range changed {
+		switch path.Base(file) {
+		case "go.mod", "go.sum", "go.work", "go.work.sum":
+			if rel := path.Dir(file); rel == "." || rel == path.Clean(subdir) {
+				for _, pkg := range pkgs {
+					mark(pkg.ImportPath)
+				}
+				continue
+			}
+		}
+
+		// a file belongs to the nearest package at or above it, which covers
+		// testdata and embedded files
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			if pkg, found := byDir[dir]; found {
+				mark(pkg.ImportPath)
+				break
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		importPath := queue[0]
+		queue = queue[1:]
+		for _, importer := range importers[importPath] {
+			mark(importer)
+		}
+	}
+
+	// packages whose tests import an affected package need testing too, but
+	// their importers don't
+	tested := map[string]bool{}
+	for importPath := range affected {
+		tested[importPath] = true
+		for _, importer := range testImporters[importPath] {
+			tested[importer] = true
+		}
+	}
+
+	result := make([]string, 0, len(tested))
+	for importPath := range tested {
+		result = append(result, importPath)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAffectedPackages(t *testing.T) {
+	// a module in the tools subdirectory, where cli imports lib, and lib's
+	// tests import testutil
+	pkgs := []*goListPackage{
+		{ImportPath: "example.com/tools/cli", Dir: "/src/tools/cli", Imports: []string{"example.com/tools/lib"}},
+		{ImportPath: "example.com/tools/lib", Dir: "/src/tools/lib", XTestImports: []string{"example.com/tools/testutil"}},
+		{ImportPath: "example.com/tools/testutil", Dir: "/src/tools/testutil"},
+		{ImportPath: "example.com/tools/other", Dir: "/src/tools/other"},
+	}
+	for changed, want := range map[string][]string{
+		"tools/lib/lib.go":                {"example.com/tools/cli", "example.com/tools/lib"},
+		"tools/other/testdata/golden.txt": {"example.com/tools/other"},
+		"tools/testutil/util.go":          {"example.com/tools/lib", "example.com/tools/testutil"},
+		"tools/go.mod":                    {"example.com/tools/cli", "example.com/tools/lib", "example.com/tools/other", "example.com/tools/testutil"},
+		"docs/go.mod":                     {},
+	} {
+		if got := affectedPackages(pkgs, "tools", []string{changed}); !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", changed, got, want)
+		}
+	}
+}
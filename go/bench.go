@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// BenchResult is the outcome of a benchmark run.
+type BenchResult struct {
+	// The raw go test -bench output, as read by benchstat.
+	Output string
+
+	// Results for each benchmark run, one per -count.
+	Benchmarks []*Benchmark
+
+	// A benchstat comparison against the baseline, if one was given.
+	Comparison string
+
+	// Benchmarks that got significantly slower than the baseline.
+	Regressions []*BenchRegression
+}
+
+// Benchmark is the result of a single benchmark run.
+type Benchmark struct {
+	// The import path of the package containing the benchmark.
+	Package string
+
+	// The name of the benchmark, including the GOMAXPROCS suffix, e.g.
+	// BenchmarkFoo-8.
+	Name string
+
+	// The number of iterations run.
+	Iterations int
+
+	// Nanoseconds per iteration.
+	NsPerOp float64
+
+	// Bytes allocated per iteration, with -benchmem.
+	BytesPerOp float64
+
+	// Allocations per iteration, with -benchmem.
+	AllocsPerOp float64
+}
+
+// BenchRegression is a benchmark that got slower than its baseline.
+type BenchRegression struct {
+	// The name of the benchmark.
+	Name string
+
+	// The change in time per operation, as a percentage.
+	Delta float64
+}
+
+// benchstatVersion is the version of golang.org/x/perf to install benchstat
+// from. x/perf has no releases, so pin a known-good commit.
+const benchstatVersion = "v0.0.0-20240716160700-783bcb78a185"
+
+// Bench runs benchmarks using go test -bench, optionally comparing them
+// against a baseline with benchstat.
+//
+// benchstat is installed unless the base container already has it. To compare
+// offline, either use a base with benchstat installed or configure WithGoProxy
+// with a directory that contains the pinned version of golang.org/x/perf.
+func (g *Go) Bench(
+	ctx context.Context,
+	// The directory containing code to benchmark.
+	src *dagger.Directory,
+	// Subdirectory in which to run the benchmarks, i.e. go test -C.
+	// +optional
+	subdir string,
+	// Packages to benchmark.
+	// +optional
+	packages []string,
+	// Regular expression selecting benchmarks to run.
+	// +optional
+	// +default="."
+	bench string,
+	// Number of times to run each benchmark.
+	// +optional
+	// +default=6
+	count int,
+	// Time or iterations to run each benchmark for, e.g. 2s or 100x.
+	// +optional
+	benchtime string,
+	// Raw output from a previous run to compare against.
+	// +optional
+	baseline *dagger.File,
+	// Another revision of the source to benchmark and compare against.
+	// +optional
+	baselineSrc *dagger.Directory,
+	// Fail if any benchmark's time per operation regresses by more than this
+	// percentage. Only statistically significant changes are considered.
+	// +optional
+	threshold float64,
+) (*BenchResult, error) {
+	goTest := []string{"go", "test"}
+	if subdir != "" {
+		goTest = append(goTest, "-C", subdir)
+	}
+	goTest = append(goTest,
+		"-run=^$",
+		"-bench="+bench,
+		"-benchmem",
+		fmt.Sprintf("-count=%d", count),
+	)
+	if benchtime != "" {
+		goTest = append(goTest, "-benchtime="+benchtime)
+	}
+	if len(packages) == 0 {
+		goTest = append(goTest, "./...")
+	} else {
+		goTest = append(goTest, packages...)
+	}
+
+	output, err := g.runBench(ctx, src, goTest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BenchResult{
+		Output:     output,
+		Benchmarks: parseBenchmarks(output),
+	}
+
+	var baselineOutput string
+	switch {
+	case baseline != nil:
+		baselineOutput, err = baseline.Contents(ctx)
+	case baselineSrc != nil:
+		baselineOutput, err = g.runBench(ctx, baselineSrc, goTest)
+	default:
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	benchstat := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		With(g.BinPath).
+		WithEnvVariable("BENCHSTAT_VERSION", benchstatVersion).
+		WithExec([]string{"sh", "-c",
+			`command -v benchstat >/dev/null || go install golang.org/x/perf/cmd/benchstat@"$BENCHSTAT_VERSION"`}).
+		WithWorkdir("/bench").
+		WithNewFile("/bench/baseline", baselineOutput).
+		WithNewFile("/bench/current", output)
+
+	result.Comparison, err = benchstat.
+		WithExec([]string{"benchstat", "baseline", "current"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	comparisonCSV, err := benchstat.
+		WithExec([]string{"benchstat", "-format", "csv", "baseline", "current"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Regressions, err = parseBenchstatRegressions(comparisonCSV)
+	if err != nil {
+		return nil, err
+	}
+
+	if threshold > 0 {
+		var errs []error
+		for _, reg := range result.Regressions {
+			if reg.Delta > threshold {
+				errs = append(errs, fmt.Errorf("%s: +%.2f%%", reg.Name, reg.Delta))
+			}
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%d benchmarks regressed by more than %.2f%%:\n%w\n\n%s",
+				len(errs), threshold, errors.Join(errs...), result.Comparison)
+		}
+	}
+
+	return result, nil
+}
+
+// runBench runs the given benchmark command against the source and returns
+// its output.
+func (g *Go) runBench(ctx context.Context, src *dagger.Directory, goTest []string) (string, error) {
+	return g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		With(Cd("/src", src)).
+		WithExec(goTest).
+		Stdout(ctx)
+}
+
+// parseBenchmarks parses benchmark results from go test -bench output.
+func parseBenchmarks(output string) []*Benchmark {
+	var benchmarks []*Benchmark
+	var pkg string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = name
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		iterations, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		bench := &Benchmark{
+			Package:    pkg,
+			Name:       fields[0],
+			Iterations: iterations,
+		}
+		// the remaining fields are value/unit pairs
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				bench.NsPerOp = value
+			case "B/op":
+				bench.BytesPerOp = value
+			case "allocs/op":
+				bench.AllocsPerOp = value
+			}
+		}
+		benchmarks = append(benchmarks, bench)
+	}
+	return benchmarks
+}
+
+// parseBenchstatRegressions finds benchmarks whose time per operation
+// increased significantly in benchstat -format csv output.
+func parseBenchstatRegressions(comparison string) ([]*BenchRegression, error) {
+	r := csv.NewReader(strings.NewReader(comparison))
+	r.FieldsPerRecord = -1
+
+	var regressions []*BenchRegression
+	var unit string
+	deltaIdx := -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parse benchstat output: %w", err)
+		}
+
+		if len(record) < 2 {
+			// config lines like goos: linux
+			continue
+		}
+
+		if record[0] == "" {
+			// a header row; the one naming units also has the delta column
+			for i, col := range record {
+				if col == "vs base" {
+					unit = record[1]
+					deltaIdx = i
+				}
+			}
+			continue
+		}
+
+		if unit != "sec/op" || deltaIdx == -1 || deltaIdx >= len(record) || record[0] == "geomean" {
+			continue
+		}
+
+		// insignificant changes are reported as ~
+		delta, ok := strings.CutSuffix(record[deltaIdx], "%")
+		if !ok {
+			continue
+		}
+		pct, err := strconv.ParseFloat(delta, 64)
+		if err != nil || pct <= 0 {
+			continue
+		}
+		regressions = append(regressions, &BenchRegression{
+			Name:  record[0],
+			Delta: pct,
+		})
+	}
+	return regressions, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestParseBenchstatRegressions(t *testing.T) {
+	regressions, err := parseBenchstatRegressions(`goos: linux
+,base.txt,,head.txt,,,
+,sec/op,CI,sec/op,CI,vs base,P
+Parse-8,1.0e-06,2%,1.5e-06,1%,+50.00%,p=0.008 n=5
+Fast-8,2.0e-06,1%,1.9e-06,1%,-5.00%,p=0.008 n=5
+Same-8,3.0e-06,1%,3.1e-06,1%,~,p=0.548 n=5
+geomean,1.8e-06,,2.0e-06,,+12.00%,
+,base.txt,,head.txt,,,
+,B/op,CI,B/op,CI,vs base,P
+Alloc-8,100,0%,200,0%,+100.00%,p=0.008 n=5
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only significant slowdowns in time per operation count
+	if len(regressions) != 1 || regressions[0].Name != "Parse-8" || regressions[0].Delta != 50 {
+		t.Errorf("got %d regressions, want Parse-8 +50%%", len(regressions))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// CoverageReport is a coverage profile along with reports derived from it.
+type CoverageReport struct {
+	// The coverage profile, as written by go test -coverprofile.
+	Profile *dagger.File
+
+	// An HTML report, as generated by go tool cover -html.
+	HTML *dagger.File
+
+	// A per-function report, as generated by go tool cover -func.
+	Func *dagger.File
+
+	// The percentage of statements covered across all packages.
+	Total float64
+
+	// Coverage for each package, sorted by name.
+	Packages []*PackageCoverage
+}
+
+// PackageCoverage is the coverage of a single package.
+type PackageCoverage struct {
+	// The import path of the package.
+	Name string
+
+	// The number of statements in the package.
+	Statements int
+
+	// The number of statements that were covered.
+	Covered int
+
+	// The percentage of statements covered.
+	Percent float64
+}
+
+// Check returns an error if total coverage is below the given percentage.
+func (r *CoverageReport) Check(
+	// The minimum acceptable coverage percentage.
+	minimum float64,
+) error {
+	if r.Total < minimum {
+		return fmt.Errorf("coverage %.1f%% is below minimum %.1f%%", r.Total, minimum)
+	}
+	return nil
+}
+
+// MergeCoverage merges coverage profiles from several test runs into a single
+// report.
+//
+// This is useful for combining coverage from tests run in different
+// subdirectories or with different build tags.
+func (g *Go) MergeCoverage(
+	ctx context.Context,
+	// The directory containing the code that was tested.
+	src *dagger.Directory,
+	// Coverage profiles to merge, as written by go test -coverprofile.
+	profiles []*dagger.File,
+	// Subdirectory containing the Go module, used to resolve packages when
+	// generating reports.
+	// +optional
+	subdir string,
+) (*CoverageReport, error) {
+	merged := &coverProfile{}
+	for _, profile := range profiles {
+		content, err := profile.Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseCoverProfile(content)
+		if err != nil {
+			return nil, err
+		}
+		if err := merged.Merge(parsed); err != nil {
+			return nil, err
+		}
+	}
+	return g.coverageReport(src, subdir, merged), nil
+}
+
+// coverageReport writes the profile and lazily generates reports from it.
+func (g *Go) coverageReport(src *dagger.Directory, subdir string, profile *coverProfile) *CoverageReport {
+	profileFile := dag.Directory().
+		WithNewFile("cover.out", profile.String()).
+		File("cover.out")
+
+	ctr := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		WithMountedDirectory("/src", src).
+		WithWorkdir(path.Join("/src", subdir)).
+		WithMountedFile("/tmp/cover.out", profileFile)
+
+	report := &CoverageReport{
+		Profile: profileFile,
+		HTML: ctr.
+			WithExec([]string{"go", "tool", "cover", "-html=/tmp/cover.out", "-o", "/tmp/cover.html"}).
+			File("/tmp/cover.html"),
+		Func: ctr.
+			WithExec([]string{"go", "tool", "cover", "-func=/tmp/cover.out"}, dagger.ContainerWithExecOpts{
+				RedirectStdout: "/tmp/cover.txt",
+			}).
+			File("/tmp/cover.txt"),
+	}
+
+	var statements, covered int
+	for _, pkg := range profile.Packages() {
+		report.Packages = append(report.Packages, pkg)
+		statements += pkg.Statements
+		covered += pkg.Covered
+	}
+	report.Total = percent(covered, statements)
+
+	return report
+}
+
+// coverProfile is a parsed coverage profile.
+type coverProfile struct {
+	Mode string
+
+	// Execution counts keyed by block, i.e. "file:start,end numStmts".
+	Blocks map[string]int
+}
+
+// parseCoverProfile parses a profile written by go test -coverprofile.
+func parseCoverProfile(content string) (*coverProfile, error) {
+	profile := &coverProfile{
+		Blocks: map[string]int{},
+	}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if mode, ok := strings.CutPrefix(line, "mode: "); ok {
+			profile.Mode = mode
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if idx == -1 {
+			return nil, fmt.Errorf("malformed coverage line: %q", line)
+		}
+		count, err := strconv.Atoi(line[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed coverage line: %q: %w", line, err)
+		}
+		// the same block appears once per test binary with -coverpkg
+		profile.add(line[:idx], count)
+	}
+	return profile, scanner.Err()
+}
+
+// Merge adds the counts from another profile to this one.
+func (p *coverProfile) Merge(other *coverProfile) error {
+	if p.Mode == "" {
+		p.Mode = other.Mode
+	} else if other.Mode != "" && other.Mode != p.Mode {
+		return fmt.Errorf("cannot merge %s coverage with %s coverage", other.Mode, p.Mode)
+	}
+	if p.Blocks == nil {
+		p.Blocks = map[string]int{}
+	}
+	for block, count := range other.Blocks {
+		p.add(block, count)
+	}
+	return nil
+}
+
+func (p *coverProfile) add(block string, count int) {
+	if p.Mode == "set" {
+		if count > 0 {
+			p.Blocks[block] = 1
+		} else if _, found := p.Blocks[block]; !found {
+			p.Blocks[block] = 0
+		}
+		return
+	}
+	p.Blocks[block] += count
+}
+
+// String formats the profile in the format read by go tool cover.
+func (p *coverProfile) String() string {
+	blocks := make([]string, 0, len(p.Blocks))
+	for block := range p.Blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Strings(blocks)
+
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "mode: %s\n", p.Mode)
+	for _, block := range blocks {
+		fmt.Fprintf(out, "%s %d\n", block, p.Blocks[block])
+	}
+	return out.String()
+}
+
+// Packages computes statement coverage for each package in the profile.
+func (p *coverProfile) Packages() []*PackageCoverage {
+	byName := map[string]*PackageCoverage{}
+	for block, count := range p.Blocks {
+		file, rest, _ := strings.Cut(block, ":")
+		_, numStmts, _ := strings.Cut(rest, " ")
+		stmts, err := strconv.Atoi(numStmts)
+		if err != nil {
+			continue
+		}
+		name := path.Dir(file)
+		pkg, found := byName[name]
+		if !found {
+			pkg = &PackageCoverage{Name: name}
+			byName[name] = pkg
+		}
+		pkg.Statements += stmts
+		if count > 0 {
+			pkg.Covered += stmts
+		}
+	}
+
+	pkgs := make([]*PackageCoverage, 0, len(byName))
+	for _, pkg := range byName {
+		pkg.Percent = percent(pkg.Covered, pkg.Statements)
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	return pkgs
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
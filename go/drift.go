@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// Drift is the difference between a source directory and the same directory
+// after regenerating files.
+type Drift struct {
+	// Files that differ, in git diff --name-status form, e.g. "M foo.go".
+	Files []string
+
+	// A patch that brings the source up to date.
+	Patch *dagger.File
+
+	// The added and modified files, laid out relative to the source so they can
+	// be copied back into it.
+	Changes *dagger.Directory
+}
+
+// Check returns an error listing the drifted files, if there are any.
+func (d *Drift) Check() error {
+	if len(d.Files) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d files are out of date:\n%s",
+		len(d.Files), indent(strings.Join(d.Files, "\n")+"\n", "  "))
+}
+
+// GenerateDrift runs go generate ./... and compares the result against the
+// source.
+func (g *Go) GenerateDrift(
+	ctx context.Context,
+	src *dagger.Directory,
+	// Subdirectory in which to run go generate.
+	// +optional
+	subdir string,
+) (*Drift, error) {
+	return g.drift(ctx, src, g.Generate(src, subdir))
+}
+
+// CheckGenerate returns an error if running go generate ./... changes any
+// files.
+func (g *Go) CheckGenerate(
+	ctx context.Context,
+	src *dagger.Directory,
+	// Subdirectory in which to run go generate.
+	// +optional
+	subdir string,
+) error {
+	drift, err := g.GenerateDrift(ctx, src, subdir)
+	if err != nil {
+		return err
+	}
+	if err := drift.Check(); err != nil {
+		return fmt.Errorf("generated code is stale; run go generate ./...\n%w", err)
+	}
+	return nil
+}
+
+// TidyDrift runs go mod tidy and compares the result against the source.
+func (g *Go) TidyDrift(
+	ctx context.Context,
+	src *dagger.Directory,
+	// Subdirectory in which to run go mod tidy.
+	// +optional
+	subdir string,
+) (*Drift, error) {
+	return g.drift(ctx, src, g.Tidy(src, subdir))
+}
+
+// CheckTidy returns an error if running go mod tidy changes any files.
+func (g *Go) CheckTidy(
+	ctx context.Context,
+	src *dagger.Directory,
+	// Subdirectory in which to run go mod tidy.
+	// +optional
+	subdir string,
+) error {
+	drift, err := g.TidyDrift(ctx, src, subdir)
+	if err != nil {
+		return err
+	}
+	if err := drift.Check(); err != nil {
+		return fmt.Errorf("go.mod is not tidy; run go mod tidy\n%w", err)
+	}
+	return nil
+}
+
+// drift compares two versions of a directory using git, respecting any
+// .gitignore files.
+func (g *Go) drift(ctx context.Context, before, after *dagger.Directory) (*Drift, error) {
+	ctr := stageDrift(before, after)
+
+	lines, err := diffNameStatus(ctx, ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, line := range lines {
+		files = append(files, strings.ReplaceAll(line, "\t", " "))
+	}
+
+	return &Drift{
+		Files: files,
+		Patch: ctr.
+			WithExec([]string{"git", "diff", "--cached", "--binary"}, dagger.ContainerWithExecOpts{
+				RedirectStdout: "/tmp/drift.patch",
+			}).
+			File("/tmp/drift.patch"),
+		Changes: before.Diff(after),
+	}, nil
+}
+
+// stageDrift returns a container in which git diff --cached compares two
+// versions of a directory.
+//
+// It is its own container, since the base image may not have git, e.g.
+// golang:alpine.
+func stageDrift(before, after *dagger.Directory) *dagger.Container {
+	ctr := dag.Container().
+		From("alpine").
+		WithExec([]string{"apk", "add", "--no-cache", "git"}).
+		WithMountedDirectory("/before", before).
+		WithMountedDirectory("/after", after).
+		WithEnvVariable("GIT_DIR", "/tmp/drift.git")
+	for _, cmd := range driftGit("/before", "/after") {
+		ctr = ctr.WithExec(cmd)
+	}
+	return ctr
+}
+
+// diffNameStatus returns the lines of git diff --cached --name-status, with
+// the status and paths separated by tabs, e.g. "R100\told.go\tnew.go".
+func diffNameStatus(ctx context.Context, ctr *dagger.Container) ([]string, error) {
+	out, err := ctr.
+		WithExec([]string{"git", "-c", "core.quotePath=false", "diff", "--cached", "--name-status"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// driftGit returns the git commands that commit the before directory and stage
+// the after directory, so git diff --cached compares them. They expect $GIT_DIR
+// to be set; the repository has no work tree of its own, so every command that
+// needs one is given it.
+func driftGit(before, after string) [][]string {
+	return [][]string{
+		{"git", "init", "-q"},
+		{"git", "--work-tree=" + before, "add", "-A"},
+		{"git", "--work-tree=" + before,
+			"-c", "user.name=drift",
+			"-c", "user.email=drift@localhost",
+			"commit", "-q", "--allow-empty", "--no-verify", "-m", "before"},
+		{"git", "--work-tree=" + after, "add", "-A"},
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDriftGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmp := t.TempDir()
+	before, after := filepath.Join(tmp, "before"), filepath.Join(tmp, "after")
+	for path, content := range map[string]string{
+		"before/.gitignore": "*.out\n",
+		"before/same.go":    "package same\n",
+		"before/stale.go":   "package stale\n",
+		"after/.gitignore":  "*.out\n",
+		"after/same.go":     "package same\n",
+		"after/stale.go":    "package stale // regenerated\n",
+		"after/new.go":      "package stale\n",
+		"after/ignored.out": "build output\n",
+	} {
+		path = filepath.Join(tmp, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git := func(args ...string) string {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = tmp
+		cmd.Env = append(os.Environ(), "GIT_DIR="+filepath.Join(tmp, "drift.git"))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	for _, cmd := range driftGit(before, after) {
+		git(cmd...)
+	}
+
+	want := "A\tnew.go\nM\tstale.go\n"
+	if got := git("git", "diff", "--cached", "--name-status"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
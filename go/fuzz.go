@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"gomod/internal/dagger"
+)
+
+// FuzzResult is the outcome of a fuzzing run.
+type FuzzResult struct {
+	// Whether the fuzzer found a failing input, or failed to run.
+	Failed bool
+
+	// The output of go test -fuzz.
+	Output string
+
+	// Failing inputs found by this run, laid out relative to the source
+	// directory so they can be committed as regression seeds. Inputs restored
+	// from previous runs are not included.
+	Crashers *dagger.Directory
+}
+
+// Fuzz runs a fuzz target with go test -fuzz.
+//
+// The generated corpus is kept in a cache volume mounted at $GOCACHE/fuzz.
+// Failing inputs written to testdata/fuzz/<target> are kept in a second cache
+// volume and restored on the next run, so they keep failing until fixed. By
+// default that volume is specific to the module, package, and target.
+func (g *Go) Fuzz(
+	ctx context.Context,
+	// The directory containing code to fuzz.
+	src *dagger.Directory,
+	// The name of the fuzz target, e.g. FuzzParse.
+	target string,
+	// The package containing the fuzz target.
+	// +optional
+	// +default="."
+	pkg string,
+	// Subdirectory containing the Go module.
+	// +optional
+	subdir string,
+	// How long to fuzz for, e.g. 30s or 1000x.
+	// +optional
+	// +default="1m"
+	fuzzTime string,
+	// Cache volume for the generated corpus.
+	// +optional
+	corpus *dagger.CacheVolume,
+	// Cache volume for failing inputs of this target.
+	// +optional
+	seeds *dagger.CacheVolume,
+) (*FuzzResult, error) {
+	if corpus == nil {
+		corpus = dag.CacheVolume("go-fuzz")
+	}
+	if seeds == nil {
+		goMod, err := src.File(path.Join(subdir, "go.mod")).Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		seeds = dag.CacheVolume("go-fuzz-seeds-" + path.Join(parseModulePath(goMod), pkg) + "-" + target)
+	}
+
+	testdata := path.Join(subdir, pkg, "testdata", "fuzz", target)
+
+	ctr := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		WithMountedCache("/go/build-cache/fuzz", corpus).
+		WithMountedCache("/tmp/fuzz-seeds", seeds).
+		With(Cd("/src", src)).
+		WithEnvVariable("TESTDATA", testdata).
+		WithEnvVariable("SEEDS", "/tmp/fuzz-seeds")
+
+	goTest := []string{"go", "test"}
+	if subdir != "" {
+		goTest = append(goTest, "-C", subdir)
+	}
+	goTest = append(goTest,
+		"-run=^$",
+		"-fuzz=^"+target+"$",
+		"-fuzztime="+fuzzTime,
+		pkg,
+	)
+
+	// the run depends on the cache volumes, not just its inputs, so never
+	// reuse a previous run
+	restored := ctr.
+		WithEnvVariable("NOW", time.Now().String()).
+		WithExec([]string{"sh", "-c", `mkdir -p "$TESTDATA" && cp -Rn "$SEEDS"/. "$TESTDATA"/`})
+
+	ctr = restored.
+		WithExec(goTest, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+	exitCode, err := ctr.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := ctr.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := ctr.Stderr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// save any new failing inputs for the next run
+	ctr, err = ctr.
+		WithExec([]string{"sh", "-c", `cp -Rn "$TESTDATA"/. "$SEEDS"/`}).
+		Sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// only report inputs found by this run, not restored seeds
+	crashers := dag.Directory().WithDirectory("/", restored.Directory("/src").Diff(ctr.Directory("/src")), dagger.DirectoryWithDirectoryOpts{
+		Include: []string{testdata + "/**"},
+	})
+
+	return &FuzzResult{
+		Failed:   exitCode != 0,
+		Output:   stdout + stderr,
+		Crashers: crashers,
+	}, nil
+}
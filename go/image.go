@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// Image builds static binaries and packages them into a minimal runtime
+// image, returning one container per platform.
+//
+// The containers can be published together as a multi-platform image by
+// passing all but the first as platform variants to Publish.
+func (g *Go) Image(
+	ctx context.Context,
+	// The directory containing code to build.
+	src *dagger.Directory,
+	// Packages to build. Binaries are placed in /usr/local/bin.
+	// +optional
+	packages []string,
+	// Platforms to build images for. Defaults to the engine's platform.
+	// +optional
+	platforms []dagger.Platform,
+	// The runtime base: scratch, distroless, wolfi, or an image reference.
+	// +optional
+	// +default="scratch"
+	base string,
+	// The entrypoint of the image. Defaults to the binary, if only one was
+	// built.
+	// +optional
+	entrypoint []string,
+	// The user to run as.
+	// +optional
+	// +default="65532"
+	user string,
+	// Labels to set on the image, in key=value form.
+	// +optional
+	labels []string,
+	// Whether to install CA certificates from the build container.
+	// +optional
+	// +default=true
+	caCertificates bool,
+	// -X definitions to pass to go build -ldflags.
+	// +optional
+	xDefs []string,
+) ([]*dagger.Container, error) {
+	if len(platforms) == 0 {
+		platform, err := dag.DefaultPlatform(ctx)
+		if err != nil {
+			return nil, err
+		}
+		platforms = []dagger.Platform{platform}
+	}
+
+	if len(packages) == 0 {
+		packages = []string{"."}
+	}
+
+	var images []*dagger.Container
+	for _, platform := range platforms {
+		goos, goarch, variant, err := parsePlatform(string(platform))
+		if err != nil {
+			return nil, err
+		}
+
+		builder := g
+		if variant != "" {
+			// Build has no notion of variants, so set one on a copy
+			withVariant := *g
+			withVariant.Base = g.Base.With(goarchVariant(goarch, variant))
+			builder = &withVariant
+		}
+
+		bins, err := builder.Build(ctx, src, packages, "", xDefs, true, false, goos, goarch, nil, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entrypoint) == 0 {
+			entries, err := bins.Entries(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(entries) != 1 {
+				return nil, fmt.Errorf("built %d binaries (%s); an entrypoint must be given",
+					len(entries), strings.Join(entries, ", "))
+			}
+			entrypoint = []string{"/usr/local/bin/" + entries[0]}
+		}
+
+		ctr := dag.Container(dagger.ContainerOpts{Platform: platform})
+		switch base {
+		case "scratch":
+		case "distroless":
+			ctr = ctr.From("gcr.io/distroless/static-debian12")
+		case "wolfi":
+			ctr = ctr.From("cgr.dev/chainguard/static")
+		default:
+			ctr = ctr.From(base)
+		}
+
+		if caCertificates {
+			ctr = ctr.WithFile("/etc/ssl/certs/ca-certificates.crt",
+				g.Base.File("/etc/ssl/certs/ca-certificates.crt"))
+		}
+
+		for _, label := range labels {
+			key, value, ok := strings.Cut(label, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid label %q: expected key=value", label)
+			}
+			ctr = ctr.WithLabel(key, value)
+		}
+
+		images = append(images, ctr.
+			WithDirectory("/usr/local/bin", bins).
+			WithUser(user).
+			WithEntrypoint(entrypoint))
+	}
+
+	return images, nil
+}
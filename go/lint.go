@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// LintResult is the outcome of a golangci-lint run.
+type LintResult struct {
+	// Issues reported by the linters.
+	Issues []*LintIssue
+
+	// The source with automatic fixes applied, if fixing was enabled.
+	Fixed *dagger.Directory
+}
+
+// LintIssue is a single issue reported by a linter.
+type LintIssue struct {
+	// The linter that reported the issue.
+	Linter string
+
+	// The file containing the issue, relative to the source directory.
+	File string
+
+	// The line of the issue.
+	Line int
+
+	// The column of the issue.
+	Column int
+
+	// A description of the issue.
+	Message string
+
+	// The severity of the issue, if the configuration assigns one.
+	Severity string
+}
+
+// Check returns an error listing the issues, if there are any.
+func (r *LintResult) Check() error {
+	if len(r.Issues) == 0 {
+		return nil
+	}
+	errs := make([]error, len(r.Issues))
+	for i, issue := range r.Issues {
+		errs[i] = fmt.Errorf("%s:%d:%d: %s (%s)",
+			issue.File, issue.Line, issue.Column, issue.Message, issue.Linter)
+	}
+	return fmt.Errorf("%d lint issues:\n%w", len(r.Issues), errors.Join(errs...))
+}
+
+// golangciReport is the subset of golangci-lint --out-format json output that
+// we care about. Both the flag and this format are golangci-lint v1's; v2
+// replaced them with --output.json.path, so bumping the pinned version past v1
+// means updating both.
+type golangciReport struct {
+	Issues []struct {
+		FromLinter string
+		Text       string
+		Severity   string
+		Pos        struct {
+			Filename string
+			Line     int
+			Column   int
+		}
+	}
+}
+
+// newLintResult collects the results of a golangci-lint run.
+func newLintResult(ctx context.Context, ctr *dagger.Container, fix bool) (*LintResult, error) {
+	exitCode, err := ctr.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0 means no issues and 1 means issues were found; anything else means
+	// golangci-lint itself failed
+	if exitCode != 0 && exitCode != 1 {
+		stderr, err := ctr.Stderr(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("golangci-lint exited %d:\n%s", exitCode, stderr)
+	}
+
+	out, err := ctr.File("/tmp/lint.json").Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var report golangciReport
+	// the JSON report may be followed by a text summary
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&report); err != nil {
+		return nil, fmt.Errorf("decode golangci-lint report: %w", err)
+	}
+
+	result := &LintResult{}
+	for _, issue := range report.Issues {
+		result.Issues = append(result.Issues, &LintIssue{
+			Linter:   issue.FromLinter,
+			File:     issue.Pos.Filename,
+			Line:     issue.Pos.Line,
+			Column:   issue.Pos.Column,
+			Message:  issue.Text,
+			Severity: issue.Severity,
+		})
+	}
+
+	if fix {
+		result.Fixed = ctr.Directory("/src")
+	}
+
+	return result, nil
+}
@@ -3,8 +3,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"gomod/internal/dagger"
+	"path"
 	"strings"
 )
 
@@ -12,18 +14,62 @@ type Go struct {
 	Base       *dagger.Container
 	ModCache   *dagger.CacheVolume
 	BuildCache *dagger.CacheVolume
+
+	// Module path patterns to fetch directly, bypassing the proxy and
+	// checksum database.
+	GoPrivate []string
+	// The GOPROXY to fetch modules from.
+	GoProxy string
+
+	// +private
+	GoProxyDir *dagger.Directory
+	// +private
+	Netrc *dagger.Secret
+	// +private
+	GitCredentials []*GitCredential
 }
 
 func New(
+	ctx context.Context,
 	// +optional
 	base *dagger.Container,
 	// +optional
 	modCache *dagger.CacheVolume,
 	// +optional
 	buildCache *dagger.CacheVolume,
-) *Go {
+	// A Go module whose go.mod determines the Go version to use when no base
+	// or version is given.
+	//
+	// The base container's Go version is checked against the module's
+	// requirement.
+	//
+	// +optional
+	src *dagger.Directory,
+	// The Go version to use when no base is given, e.g. 1.23 or 1.23.2.
+	// +optional
+	version string,
+	// The base image variant to use when no base is given: debian, alpine,
+	// distroless (Debian 12, matching distroless runtime images), or wolfi.
+	// +optional
+	// +default="debian"
+	variant string,
+) (*Go, error) {
 	if base == nil {
-		base = dag.Container().From("golang:1")
+		if version == "" && src != nil {
+			var err error
+			version, err = goModVersion(ctx, src)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if version == "" {
+			version = "1"
+		}
+		image, err := goImage(version, variant)
+		if err != nil {
+			return nil, err
+		}
+		base = dag.Container().With(image)
 	}
 	if modCache == nil {
 		modCache = dag.CacheVolume("go-mod")
@@ -31,21 +77,38 @@ func New(
 	if buildCache == nil {
 		buildCache = dag.CacheVolume("go-build")
 	}
-	return &Go{
+	g := &Go{
 		Base:       base,
 		ModCache:   modCache,
 		BuildCache: buildCache,
 	}
+	if src != nil {
+		if err := g.CheckVersion(ctx, src); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
 }
 
 // FromVersion sets the base image to the given Go version.
-func (g *Go) FromVersion(version string) *Go {
-	g.Base = g.Base.From("golang:" + version)
-	return g
+func (g *Go) FromVersion(
+	version string,
+	// The base image variant: debian, alpine, distroless, or wolfi.
+	// +optional
+	// +default="debian"
+	variant string,
+) (*Go, error) {
+	image, err := goImage(version, variant)
+	if err != nil {
+		return nil, err
+	}
+	g.Base = g.Base.With(image)
+	return g, nil
 }
 
 // Build builds Go code using the go build CLI.
 func (g *Go) Build(
+	ctx context.Context,
 	// The directory containing code to build.
 	src *dagger.Directory,
 	// Packages to build.
@@ -72,9 +135,17 @@ func (g *Go) Build(
 	// Arbitrary flags to pass along to go build.
 	// +optional
 	buildFlags []string,
-) *dagger.Directory {
+	// Build a second time from a different path with an empty build cache,
+	// and fail if the binaries differ.
+	// +optional
+	verifyReproducible bool,
+	// Write a CycloneDX SBOM next to each binary, named <binary>.cdx.json.
+	// +optional
+	sbom bool,
+) (*dagger.Directory, error) {
 	ctr := g.Base.
 		With(g.GlobalCache).
+		With(g.PrivateModules).
 		WithDirectory("/out", dag.Directory()).
 		With(Cd("/src", src))
 
@@ -111,15 +182,38 @@ func (g *Go) Build(
 		WithExec(cmd).
 		Directory("/out")
 
+	if verifyReproducible {
+		rebuilt := ctr.
+			WithMountedTemp("/go/build-cache").
+			With(Cd("/rebuild", src)).
+			WithExec(cmd).
+			Directory("/out")
+		if err := g.compareBuilds(ctx, out, rebuilt); err != nil {
+			return nil, err
+		}
+	}
+
+	if sbom {
+		var err error
+		out, err = g.withSBOMs(ctx, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if subdir != "" {
 		out = dag.Directory().WithDirectory(subdir, out)
 	}
 
-	return out
+	return out, nil
 }
 
-// Test runs tests using the go test CLI.
+// Test runs tests using the go test CLI and returns structured results.
+//
+// Test failures do not fail the call; inspect the result, or call Check on it,
+// to find out whether the tests passed.
 func (g *Go) Test(
+	ctx context.Context,
 	// The directory containing code to test.
 	src *dagger.Directory,
 	// Subdirectory in which to run the tests, i.e. go run -C.
@@ -147,44 +241,55 @@ func (g *Go) Test(
 	// Enable experimental Dagger nesting.
 	// +optional
 	nest bool,
-) (*dagger.Container, error) {
-	ctr := g.Base.
-		With(g.GlobalCache).
-		WithMountedDirectory("/src", src).
-		WithWorkdir("/src")
-
-	pkgs := packages
-	if len(pkgs) == 0 {
-		pkgs = []string{"./..."}
+	// Collect a coverage profile across all packages.
+	// +optional
+	coverage bool,
+	// Split packages into this many shards and test each shard in its own
+	// container, in parallel.
+	// +optional
+	shards int,
+	// A go test -json report from a previous run, used to balance shards by
+	// package duration rather than package count.
+	// +optional
+	durations *dagger.File,
+	// Re-run failed tests up to this many times, reporting tests that pass on
+	// a retry as flaky rather than failed.
+	// +optional
+	retries int,
+) (*TestResult, error) {
+	opts := testOpts{
+		Src:                      src,
+		Subdir:                   subdir,
+		Packages:                 packages,
+		Verbose:                  verbose,
+		Race:                     race,
+		TestFlags:                testFlags,
+		InsecureRootCapabilities: insecureRootCapabilities,
+		Nest:                     nest,
+		Coverage:                 coverage,
 	}
-
-	goTest := []string{"go", "test"}
-
-	if subdir != "" {
-		goTest = append(goTest, "-C", subdir)
+	var result *TestResult
+	var err error
+	if shards > 1 {
+		result, err = g.testShards(ctx, opts, shards, durations)
+	} else {
+		result, err = g.runTests(ctx, opts)
 	}
-
-	if race {
-		goTest = append(goTest, "-race")
+	if err != nil {
+		return nil, err
 	}
-
-	if verbose {
-		goTest = append(goTest, "-v")
+	if retries > 0 {
+		if err := g.retryFailures(ctx, opts, result, retries); err != nil {
+			return nil, err
+		}
 	}
-
-	goTest = append(goTest, testFlags...)
-
-	goTest = append(goTest, pkgs...)
-
-	return ctr.WithExec(goTest, dagger.ContainerWithExecOpts{
-		InsecureRootCapabilities:      insecureRootCapabilities,
-		ExperimentalPrivilegedNesting: nest,
-	}), nil
+	return result, nil
 }
 
 // Gotestsum runs tests using the gotestsum CLI.
 //
-// The base container must have the gotestsum CLI installed.
+// The base container must have the gotestsum CLI installed. All packages run in
+// the one returned container; use Test to split them into shards.
 func (g *Go) Gotestsum(
 	// The directory containing code to test.
 	src *dagger.Directory,
@@ -210,6 +315,10 @@ func (g *Go) Gotestsum(
 	// Arbitrary flags to pass along to gotestsum.
 	// +optional
 	gotestsumFlags []string,
+	// Re-run failed tests up to this many times, i.e. gotestsum
+	// --rerun-fails.
+	// +optional
+	rerunFails int,
 ) *dagger.Container {
 	cmd := []string{
 		"gotestsum",
@@ -220,7 +329,17 @@ func (g *Go) Gotestsum(
 	if race {
 		goTestFlags = append(goTestFlags, "-race")
 	}
-	if len(packages) > 0 {
+	if rerunFails > 0 {
+		// gotestsum needs to know the packages in order to re-run them
+		pkgs := packages
+		if len(pkgs) == 0 {
+			pkgs = []string{"./..."}
+		}
+		cmd = append(cmd,
+			fmt.Sprintf("--rerun-fails=%d", rerunFails),
+			"--packages="+strings.Join(pkgs, " "),
+		)
+	} else if len(packages) > 0 {
 		goTestFlags = append(goTestFlags, packages...)
 	}
 	if len(goTestFlags) > 0 {
@@ -229,6 +348,7 @@ func (g *Go) Gotestsum(
 	}
 	return g.Base.
 		With(g.GlobalCache).
+		With(g.PrivateModules).
 		WithMountedDirectory("/src", src).
 		WithWorkdir("/src").
 		WithExec(cmd, dagger.ContainerWithExecOpts{
@@ -238,34 +358,83 @@ func (g *Go) Gotestsum(
 }
 
 // Generate runs go generate ./... and returns the updated directory.
-func (g *Go) Generate(src *dagger.Directory) *dagger.Directory {
+func (g *Go) Generate(
+	src *dagger.Directory,
+	// Subdirectory in which to run go generate.
+	// +optional
+	subdir string,
+) *dagger.Directory {
 	return g.Base.
 		With(g.GlobalCache).
+		With(g.PrivateModules).
 		With(Cd("/src", src)).
+		WithWorkdir(path.Join("/src", subdir)).
 		WithExec([]string{"go", "generate", "./..."}).
 		Directory("/src")
 }
 
-// GolangCILint runs golangci-lint.
+// Tidy runs go mod tidy and returns the updated directory.
+func (g *Go) Tidy(
+	src *dagger.Directory,
+	// Subdirectory in which to run go mod tidy.
+	// +optional
+	subdir string,
+) *dagger.Directory {
+	return g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		With(Cd("/src", src)).
+		WithWorkdir(path.Join("/src", subdir)).
+		WithExec([]string{"go", "mod", "tidy"}).
+		Directory("/src")
+}
+
+// GolangCILint runs golangci-lint and returns its findings.
 //
-// The base container must have the golangci-lint CLI installed.
+// golangci-lint is installed unless the base container already has it.
+// Findings do not fail the call; call Check on the result to fail if there are
+// any.
 func (g *Go) GolangCILint(
+	ctx context.Context,
 	src *dagger.Directory,
+	// Subdirectory in which to run golangci-lint.
+	// +optional
+	subdir string,
 	// +optional
 	verbose bool,
 	// +optional
 	timeoutInSeconds int,
-) *dagger.Container {
-	cmd := []string{"golangci-lint", "run"}
+	// The version of golangci-lint to install. Must be v1, whose JSON output
+	// the findings are parsed from.
+	// +optional
+	// +default="v1.64.8"
+	version string,
+	// Apply automatic fixes, returning the fixed source as Fixed.
+	// +optional
+	fix bool,
+) (*LintResult, error) {
+	cmd := []string{"golangci-lint", "run", "--out-format", "json"}
 	if verbose {
 		cmd = append(cmd, "--verbose")
 	}
 	if timeoutInSeconds > 0 {
 		cmd = append(cmd, fmt.Sprintf("--timeout=%ds", timeoutInSeconds))
 	}
-	return g.Base.
+	if fix {
+		cmd = append(cmd, "--fix")
+	}
+	ctr := g.Base.
 		With(g.GlobalCache).
+		With(g.PrivateModules).
+		With(g.BinPath).
+		WithEnvVariable("GOLANGCI_LINT_VERSION", version).
+		WithExec([]string{"sh", "-c",
+			`command -v golangci-lint >/dev/null || go install github.com/golangci/golangci-lint/cmd/golangci-lint@"$GOLANGCI_LINT_VERSION"`}).
 		WithMountedDirectory("/src", src).
-		WithWorkdir("/src").
-		WithExec(cmd)
+		WithWorkdir(path.Join("/src", subdir)).
+		WithExec(cmd, dagger.ContainerWithExecOpts{
+			RedirectStdout: "/tmp/lint.json",
+			Expect:         dagger.ReturnTypeAny,
+		})
+	return newLintResult(ctx, ctr, fix)
 }
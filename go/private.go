@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// A token used by git to authenticate to a host over HTTPS.
+type GitCredential struct {
+	Host     string
+	Username string
+	Token    *dagger.Secret
+}
+
+// WithGoPrivate marks module path patterns as private, setting $GOPRIVATE and
+// $GONOSUMDB so they are fetched directly rather than through the proxy.
+func (g *Go) WithGoPrivate(
+	// Module path glob patterns, e.g. github.com/my-org/*.
+	patterns []string,
+) *Go {
+	g.GoPrivate = append(g.GoPrivate, patterns...)
+	return g
+}
+
+// WithGoProxy sets $GOPROXY.
+//
+// A directory laid out as a module proxy may be given to serve modules from
+// the filesystem, e.g. for air-gapped builds. Modules matching WithGoPrivate
+// patterns still bypass the proxy unless $GONOPROXY is set, e.g. to none.
+func (g *Go) WithGoProxy(
+	// The GOPROXY value, e.g. https://athens.example.com,direct.
+	//
+	// Defaults to file:///goproxy when a directory is given.
+	//
+	// +optional
+	url string,
+	// A directory to mount at /goproxy.
+	// +optional
+	dir *dagger.Directory,
+) *Go {
+	if dir != nil {
+		g.GoProxyDir = dir
+		if url == "" {
+			url = "file:///goproxy"
+		}
+	}
+	g.GoProxy = url
+	return g
+}
+
+// WithNetrc mounts a .netrc file used to authenticate to private module
+// hosts.
+func (g *Go) WithNetrc(netrc *dagger.Secret) *Go {
+	g.Netrc = netrc
+	return g
+}
+
+// WithGitCredential configures git to authenticate to a host with a token
+// when fetching private modules over HTTPS.
+func (g *Go) WithGitCredential(
+	// The host to authenticate to, e.g. github.com.
+	host string,
+	// The token to authenticate with.
+	token *dagger.Secret,
+	// The username to authenticate with.
+	// +optional
+	// +default="x-access-token"
+	username string,
+) *Go {
+	g.GitCredentials = append(g.GitCredentials, &GitCredential{
+		Host:     host,
+		Username: username,
+		Token:    token,
+	})
+	return g
+}
+
+// PrivateModules configures access to private modules and module proxies.
+//
+// Credentials are mounted as secrets, so they never reach the cache key.
+func (g *Go) PrivateModules(ctr *dagger.Container) *dagger.Container {
+	if len(g.GoPrivate) > 0 {
+		patterns := strings.Join(g.GoPrivate, ",")
+		ctr = ctr.
+			WithEnvVariable("GOPRIVATE", patterns).
+			WithEnvVariable("GONOSUMDB", patterns)
+	}
+
+	if g.GoProxyDir != nil {
+		ctr = ctr.WithMountedDirectory("/goproxy", g.GoProxyDir)
+	}
+
+	if g.GoProxy != "" {
+		ctr = ctr.WithEnvVariable("GOPROXY", g.GoProxy)
+	}
+
+	if g.Netrc != nil {
+		ctr = ctr.
+			WithMountedSecret("/root/.netrc", g.Netrc).
+			WithEnvVariable("NETRC", "/root/.netrc")
+	}
+
+	// configure a credential helper per host through the environment, reading
+	// each token from a secret variable
+	for i, cred := range g.GitCredentials {
+		tokenVar := fmt.Sprintf("GIT_TOKEN_%d", i)
+		ctr = ctr.
+			WithSecretVariable(tokenVar, cred.Token).
+			WithEnvVariable(fmt.Sprintf("GIT_CONFIG_KEY_%d", i),
+				"credential.https://"+cred.Host+".helper").
+			WithEnvVariable(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i),
+				fmt.Sprintf(`!f() { echo username=%s; echo "password=$%s"; }; f`, cred.Username, tokenVar))
+	}
+	if len(g.GitCredentials) > 0 {
+		ctr = ctr.WithEnvVariable("GIT_CONFIG_COUNT", fmt.Sprint(len(g.GitCredentials)))
+	}
+
+	return ctr
+}
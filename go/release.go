@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// defaultReleasePlatforms are the platforms Release builds for when none are
+// given.
+var defaultReleasePlatforms = []string{
+	"linux/amd64",
+	"linux/arm64",
+	"darwin/amd64",
+	"darwin/arm64",
+	"windows/amd64",
+}
+
+// Release cross-compiles a binary for several platforms and packages each
+// build into an archive, alongside a checksums.txt file.
+//
+// Binaries are named name_os_arch, with a .exe suffix on Windows. Windows
+// builds are archived as .zip and all others as .tar.gz.
+func (g *Go) Release(
+	// The directory containing code to build.
+	src *dagger.Directory,
+	// The name of the binary.
+	name string,
+	// The package to build.
+	// +optional
+	// +default="."
+	pkg string,
+	// Platforms to build for, in os/arch[/variant] form.
+	//
+	// Defaults to linux, darwin, and windows on amd64 and arm64.
+	//
+	// +optional
+	platforms []string,
+	// -X definitions to pass to go build -ldflags.
+	// +optional
+	xDefs []string,
+	// Arbitrary flags to pass along to go build.
+	// +optional
+	buildFlags []string,
+) (*dagger.Directory, error) {
+	if len(platforms) == 0 {
+		platforms = defaultReleasePlatforms
+	}
+
+	archiver := dag.Container().
+		From("alpine").
+		WithExec([]string{"apk", "add", "--no-cache", "zip"}).
+		WithWorkdir("/dist")
+
+	var archives []string
+	for _, platform := range platforms {
+		goos, goarch, variant, err := parsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+
+		base := fmt.Sprintf("%s_%s_%s%s", name, goos, goarch, variant)
+		bin := base
+		if goos == "windows" {
+			bin += ".exe"
+		}
+
+		ctr := g.Base.
+			With(g.GlobalCache).
+			With(g.PrivateModules).
+			WithDirectory("/out", dag.Directory()).
+			With(Cd("/src", src)).
+			WithEnvVariable("CGO_ENABLED", "0").
+			WithEnvVariable("GOOS", goos).
+			WithEnvVariable("GOARCH", goarch)
+
+		if variant != "" {
+			ctr = ctr.With(goarchVariant(goarch, variant))
+		}
+
+		cmd := []string{"go", "build"}
+		cmd = append(cmd, buildFlags...)
+		cmd = append(cmd,
+			"-o", "/out/"+bin,
+			"-trimpath", // unconditional for reproducible builds
+		)
+		if len(xDefs) > 0 {
+			cmd = append(cmd, "-ldflags", "-X "+strings.Join(xDefs, " -X "))
+		}
+		cmd = append(cmd, pkg)
+
+		binary := ctr.WithExec(cmd).File("/out/" + bin)
+
+		archiver = archiver.WithMountedFile("/build/"+bin, binary)
+
+		var archive string
+		if goos == "windows" {
+			archive = base + ".zip"
+			archiver = archiver.WithExec([]string{"zip", "-j", archive, "/build/" + bin})
+		} else {
+			archive = base + ".tar.gz"
+			archiver = archiver.WithExec([]string{"tar", "-czf", archive, "-C", "/build", bin})
+		}
+		archives = append(archives, archive)
+	}
+
+	return archiver.
+		WithExec(append([]string{"sha256sum"}, archives...), dagger.ContainerWithExecOpts{
+			RedirectStdout: "/dist/checksums.txt",
+		}).
+		Directory("/dist"), nil
+}
+
+// parsePlatform splits an os/arch[/variant] platform into its parts.
+func parsePlatform(platform string) (goos, goarch, variant string, err error) {
+	parts := strings.Split(platform, "/")
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], "", nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	default:
+		return "", "", "", fmt.Errorf("invalid platform %q: expected os/arch[/variant]", platform)
+	}
+}
+
+// goarchVariant sets the environment variable that selects the given
+// architecture variant, e.g. GOARM=7 for arm/v7.
+func goarchVariant(goarch, variant string) dagger.WithContainerFunc {
+	return func(ctr *dagger.Container) *dagger.Container {
+		switch goarch {
+		case "arm":
+			return ctr.WithEnvVariable("GOARM", strings.TrimPrefix(variant, "v"))
+		case "amd64":
+			return ctr.WithEnvVariable("GOAMD64", variant)
+		case "arm64":
+			return ctr.WithEnvVariable("GOARM64", variant)
+		default:
+			return ctr
+		}
+	}
+}
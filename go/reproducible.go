@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// compareBuilds returns an error listing any files that differ between two
+// builds.
+func (g *Go) compareBuilds(ctx context.Context, first, second *dagger.Directory) error {
+	firstSums, err := g.checksums(ctx, first)
+	if err != nil {
+		return err
+	}
+	secondSums, err := g.checksums(ctx, second)
+	if err != nil {
+		return err
+	}
+
+	var differ []string
+	for name, sum := range firstSums {
+		if secondSums[name] != sum {
+			differ = append(differ, name)
+		}
+	}
+	for name := range secondSums {
+		if _, found := firstSums[name]; !found {
+			differ = append(differ, name)
+		}
+	}
+	if len(differ) == 0 {
+		return nil
+	}
+
+	sort.Strings(differ)
+	return fmt.Errorf("build is not reproducible; these files differ between builds:\n%s",
+		indent(strings.Join(differ, "\n")+"\n", "  "))
+}
+
+// checksums returns the SHA-256 checksum of each file in the directory.
+func (g *Go) checksums(ctx context.Context, dir *dagger.Directory) (map[string]string, error) {
+	out, err := g.Base.
+		With(Cd("/dir", dir)).
+		WithExec([]string{"sh", "-c", "find . -type f | sort | xargs -r sha256sum"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if ok {
+			sums[strings.TrimPrefix(name, "./")] = sum
+		}
+	}
+	return sums, nil
+}
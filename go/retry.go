@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// retryFailures re-runs failed tests up to the given number of times,
+// updating the result in place. Tests that pass on a retry are marked flaky.
+func (g *Go) retryFailures(ctx context.Context, opts testOpts, result *TestResult, retries int) error {
+	for attempt := range retries {
+		// re-run top-level tests, since a failed subtest fails its parent too
+		failing := map[string][]string{}
+		var pkgs []string
+		for _, pkg := range result.Packages {
+			for _, test := range pkg.Tests {
+				if test.Status == "fail" && !strings.Contains(test.Name, "/") {
+					if len(failing[pkg.Name]) == 0 {
+						pkgs = append(pkgs, pkg.Name)
+					}
+					failing[pkg.Name] = append(failing[pkg.Name], test.Name)
+				}
+			}
+		}
+		if len(pkgs) == 0 {
+			break
+		}
+
+		retried := make([]*TestResult, len(pkgs))
+		eg, ctx := errgroup.WithContext(ctx)
+		for i, pkg := range pkgs {
+			retryOpts := opts
+			retryOpts.Packages = []string{pkg}
+			retryOpts.Coverage = false
+			retryOpts.Attempt = attempt + 1
+			retryOpts.TestFlags = append(slices.Clone(opts.TestFlags),
+				"-run", runPattern(failing[pkg]))
+			eg.Go(func() error {
+				res, err := g.runTests(ctx, retryOpts)
+				if err != nil {
+					return err
+				}
+				retried[i] = res
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+
+		for _, res := range retried {
+			applyRetry(result, res)
+		}
+	}
+
+	recovered := false
+	for _, pkg := range result.Packages {
+		if pkg.Status != "fail" {
+			continue
+		}
+		var flaky, failed bool
+		for _, test := range pkg.Tests {
+			flaky = flaky || test.Flaky
+			failed = failed || test.Status == "fail"
+		}
+		if flaky && !failed {
+			pkg.Status = "pass"
+			recovered = true
+		}
+	}
+	// only forgive the exit code if it was due to tests that passed on a retry,
+	// not e.g. go vet
+	if recovered && len(result.FailedPackages()) == 0 {
+		result.ExitCode = 0
+	}
+
+	return nil
+}
+
+// applyRetry updates previously failed tests with the outcome of a retry.
+func applyRetry(result, retry *TestResult) {
+	tests := map[string]*TestCase{}
+	for _, pkg := range result.Packages {
+		for _, test := range pkg.Tests {
+			tests[test.Package+" "+test.Name] = test
+		}
+	}
+	for _, pkg := range retry.Packages {
+		for _, test := range pkg.Tests {
+			orig, found := tests[test.Package+" "+test.Name]
+			if !found || orig.Status != "fail" {
+				continue
+			}
+			orig.Attempts++
+			orig.Elapsed = test.Elapsed
+			if test.Status == "pass" {
+				// keep the output of the failed attempt for debugging
+				orig.Status = "pass"
+				orig.Flaky = true
+			}
+		}
+	}
+}
+
+// runPattern returns a -run pattern matching exactly the given test names.
+func runPattern(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// withSBOMs writes a CycloneDX SBOM next to each binary in the directory,
+// derived from the build info embedded by the Go toolchain.
+func (g *Go) withSBOMs(ctx context.Context, bins *dagger.Directory) (*dagger.Directory, error) {
+	out, err := g.Base.
+		WithMountedDirectory("/bins", bins).
+		WithExec([]string{"go", "version", "-m", "/bins"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range parseBuildInfo(out) {
+		bom, err := json.MarshalIndent(info.cycloneDX(), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(info.Binary, "/bins/")
+		bins = bins.WithNewFile(name+".cdx.json", string(bom)+"\n")
+	}
+
+	return bins, nil
+}
+
+// buildInfo is the build info of a binary, as printed by go version -m.
+type buildInfo struct {
+	Binary    string
+	GoVersion string
+	Path      string
+	Main      module
+	Deps      []module
+	Settings  [][2]string
+}
+
+type module struct {
+	Path    string
+	Version string
+}
+
+// parseBuildInfo parses the output of go version -m for any number of
+// binaries.
+func parseBuildInfo(out string) []*buildInfo {
+	var infos []*buildInfo
+	var info *buildInfo
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\t") {
+			// a new binary, e.g. /bins/foo: go1.23.2
+			binary, goVersion, ok := strings.Cut(line, ": ")
+			if !ok {
+				continue
+			}
+			info = &buildInfo{
+				Binary:    binary,
+				GoVersion: goVersion,
+			}
+			infos = append(infos, info)
+			continue
+		}
+
+		if info == nil {
+			continue
+		}
+
+		fields := strings.Split(strings.TrimPrefix(line, "\t"), "\t")
+		switch fields[0] {
+		case "path":
+			if len(fields) > 1 {
+				info.Path = fields[1]
+			}
+		case "mod":
+			if len(fields) > 2 {
+				info.Main = module{Path: fields[1], Version: fields[2]}
+			}
+		case "dep":
+			if len(fields) > 2 {
+				info.Deps = append(info.Deps, module{Path: fields[1], Version: fields[2]})
+			}
+		case "=>":
+			// replaces the preceding dependency
+			if len(fields) > 2 && len(info.Deps) > 0 {
+				info.Deps[len(info.Deps)-1] = module{Path: fields[1], Version: fields[2]}
+			}
+		case "build":
+			if len(fields) > 1 {
+				key, value, _ := strings.Cut(fields[1], "=")
+				info.Settings = append(info.Settings, [2]string{key, value})
+			}
+		}
+	}
+	return infos
+}
+
+// cycloneDXBOM is a minimal CycloneDX 1.5 document.
+type cycloneDXBOM struct {
+	BOMFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Metadata    cycloneDXMetadata    `json:"metadata"`
+	Components  []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Tools      cycloneDXTools      `json:"tools"`
+	Component  cycloneDXComponent  `json:"component"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type    string `json:"type"`
+	BOMRef  string `json:"bom-ref,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cycloneDX converts the build info to a CycloneDX SBOM.
+//
+// No timestamp or serial number is included, so that the SBOM is as
+// reproducible as the binary it describes.
+func (info *buildInfo) cycloneDX() cycloneDXBOM {
+	app := cycloneDXComponent{
+		Type: "application",
+		Name: path.Base(info.Path),
+	}
+	if info.Main.Path != "" {
+		app.BOMRef = goPURL(info.Main)
+		app.PURL = app.BOMRef
+		if info.Main.Version != "(devel)" {
+			app.Version = info.Main.Version
+		}
+	}
+
+	bom := cycloneDXBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Tools: cycloneDXTools{
+				Components: []cycloneDXComponent{
+					{
+						Type:    "application",
+						Name:    "go",
+						Version: info.GoVersion,
+					},
+				},
+			},
+			Component: app,
+		},
+		Components: []cycloneDXComponent{},
+	}
+
+	for _, setting := range info.Settings {
+		bom.Metadata.Properties = append(bom.Metadata.Properties, cycloneDXProperty{
+			Name:  "go.build." + setting[0],
+			Value: setting[1],
+		})
+	}
+
+	for _, dep := range info.Deps {
+		purl := goPURL(dep)
+		bom.Components = append(bom.Components, cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  purl,
+			Name:    dep.Path,
+			Version: dep.Version,
+			PURL:    purl,
+		})
+	}
+
+	return bom
+}
+
+// goPURL returns the package URL of a Go module.
+func goPURL(mod module) string {
+	purl := "pkg:golang/" + mod.Path
+	if mod.Version != "" && mod.Version != "(devel)" {
+		purl += "@" + mod.Version
+	}
+	return purl
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"gomod/internal/dagger"
+)
+
+// testShards splits the packages to test into shards, tests each shard in its
+// own container in parallel, and merges the results.
+func (g *Go) testShards(ctx context.Context, opts testOpts, shards int, durations *dagger.File) (*TestResult, error) {
+	pkgs, err := g.listPackages(ctx, opts.Src, opts.Subdir, opts.Packages)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := map[string]float64{}
+	if durations != nil {
+		content, err := durations.Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		events, err := parseTestEvents(strings.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range collectPackages(events) {
+			weights[pkg.Name] = pkg.Elapsed
+		}
+	}
+
+	groups := splitShards(pkgs, shards, weights)
+
+	results := make([]*TestResult, len(groups))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, group := range groups {
+		shardOpts := opts
+		shardOpts.Packages = group
+		eg.Go(func() error {
+			result, err := g.runTests(ctx, shardOpts)
+			if err != nil {
+				return err
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return g.mergeTestResults(ctx, opts, results)
+}
+
+// listPackages resolves package patterns to import paths using go list.
+func (g *Go) listPackages(ctx context.Context, src *dagger.Directory, subdir string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	goList := []string{"go", "list"}
+	if subdir != "" {
+		goList = append(goList, "-C", subdir)
+	}
+	goList = append(goList, patterns...)
+
+	out, err := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		WithMountedDirectory("/src", src).
+		WithWorkdir("/src").
+		WithExec(goList).
+		Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(out), nil
+}
+
+// splitShards distributes packages across at most n shards, balancing the
+// total weight of each shard.
+//
+// Packages with no known weight are assumed to take the average time of the
+// packages that do, so that with no weights at all the packages are split
+// evenly by count.
+func splitShards(pkgs []string, n int, weights map[string]float64) [][]string {
+	var known, total float64
+	for _, pkg := range pkgs {
+		if weight, ok := weights[pkg]; ok {
+			known++
+			total += weight
+		}
+	}
+	fallback := 1.0
+	if known > 0 && total > 0 {
+		fallback = total / known
+	}
+
+	weightOf := func(pkg string) float64 {
+		if weight, ok := weights[pkg]; ok {
+			return weight
+		}
+		return fallback
+	}
+
+	// assign the heaviest packages first, each to the lightest shard
+	sorted := append([]string(nil), pkgs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return weightOf(sorted[i]) > weightOf(sorted[j])
+	})
+
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	shards := make([][]string, n)
+	loads := make([]float64, n)
+	for _, pkg := range sorted {
+		lightest := 0
+		for i := range loads {
+			if loads[i] < loads[lightest] {
+				lightest = i
+			}
+		}
+		shards[lightest] = append(shards[lightest], pkg)
+		loads[lightest] += weightOf(pkg)
+	}
+
+	return shards
+}
+
+// mergeTestResults combines the results of several test runs into one.
+func (g *Go) mergeTestResults(ctx context.Context, opts testOpts, results []*TestResult) (*TestResult, error) {
+	merged := &TestResult{}
+
+	var reports []string
+	var profiles []*dagger.File
+	for _, result := range results {
+		merged.Packages = append(merged.Packages, result.Packages...)
+
+		if merged.ExitCode == 0 {
+			merged.ExitCode = result.ExitCode
+		}
+
+		report, err := result.Report.Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+
+		if result.Coverage != nil {
+			profiles = append(profiles, result.Coverage.Profile)
+		}
+	}
+
+	merged.Report = dag.Directory().
+		WithNewFile("test.json", strings.Join(reports, "")).
+		File("test.json")
+
+	if len(profiles) > 0 {
+		var err error
+		merged.Coverage, err = g.MergeCoverage(ctx, opts.Src, profiles, opts.Subdir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
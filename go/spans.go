@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"gomod/internal/telemetry"
+)
+
+// testSpan is a package or test span being replayed from test events.
+type testSpan struct {
+	ctx    context.Context
+	span   trace.Span
+	stdout io.WriteCloser
+}
+
+// end finishes the span with the status of the package or test.
+func (s *testSpan) end(action string, at time.Time) {
+	switch action {
+	case "fail":
+		s.span.SetStatus(codes.Error, "FAIL")
+	case "skip":
+		s.span.SetAttributes(attribute.Bool(telemetry.CanceledAttr, true))
+	}
+	s.stdout.Close()
+	s.span.End(trace.WithTimestamp(at))
+}
+
+// emitTestSpans replays a go test -json event stream as spans, one per
+// package with a child per test. Subtests are nested under their parent.
+//
+// Spans use the times recorded in the events, so they reflect when each test
+// actually ran rather than when the results were collected. Retries are tagged
+// with their attempt, so they can be told apart from the first run.
+func emitTestSpans(ctx context.Context, events []testEvent, attempt int) {
+	pkgs := map[string]*testSpan{}
+	tests := map[string]*testSpan{}
+
+	start := func(parent context.Context, name string, at time.Time, attrs ...attribute.KeyValue) *testSpan {
+		if attempt > 0 {
+			attrs = append(attrs, attribute.Int("go.test.retry", attempt))
+		}
+		spanCtx, span := Tracer().Start(parent, name,
+			trace.WithTimestamp(at),
+			trace.WithAttributes(attrs...))
+		return &testSpan{
+			ctx:    spanCtx,
+			span:   span,
+			stdout: telemetry.SpanStdio(spanCtx, "").Stdout,
+		}
+	}
+
+	forPackage := func(event testEvent) *testSpan {
+		pkg, found := pkgs[event.Package]
+		if !found {
+			name := event.Package
+			if attempt > 0 {
+				name += fmt.Sprintf(" (retry %d)", attempt)
+			}
+			pkg = start(ctx, name, event.Time,
+				attribute.String("go.test.package", event.Package))
+			pkgs[event.Package] = pkg
+		}
+		return pkg
+	}
+
+	var forTest func(event testEvent, name string) *testSpan
+	forTest = func(event testEvent, name string) *testSpan {
+		key := event.Package + " " + name
+		test, found := tests[key]
+		if !found {
+			parent := forPackage(event)
+			if i := strings.LastIndex(name, "/"); i != -1 {
+				parent = forTest(event, name[:i])
+			}
+			test = start(parent.ctx, name[strings.LastIndex(name, "/")+1:], event.Time,
+				attribute.String("go.test.package", event.Package),
+				attribute.String("go.test.name", name))
+			tests[key] = test
+		}
+		return test
+	}
+
+	buildOutput := map[string]string{}
+
+	var last time.Time
+	for _, event := range events {
+		if event.Action == "build-output" {
+			buildOutput[event.ImportPath] += event.Output
+			continue
+		}
+		if event.Package == "" {
+			continue
+		}
+		if event.Time.After(last) {
+			last = event.Time
+		}
+
+		var span *testSpan
+		if event.Test == "" {
+			span = forPackage(event)
+		} else {
+			span = forTest(event, event.Test)
+		}
+
+		switch event.Action {
+		case "output":
+			fmt.Fprint(span.stdout, event.Output)
+		case "pass", "fail", "skip":
+			if event.FailedBuild != "" {
+				fmt.Fprint(span.stdout, buildOutput[event.FailedBuild])
+			}
+			span.end(event.Action, event.Time)
+			if event.Test == "" {
+				delete(pkgs, event.Package)
+			} else {
+				delete(tests, event.Package+" "+event.Test)
+			}
+		}
+	}
+
+	// anything left never finished, e.g. the test binary panicked or timed
+	// out; end subtests before their parents
+	unfinished := make([]string, 0, len(tests))
+	for key := range tests {
+		unfinished = append(unfinished, key)
+	}
+	sort.Slice(unfinished, func(i, j int) bool {
+		return strings.Count(unfinished[i], "/") > strings.Count(unfinished[j], "/")
+	})
+	for _, key := range unfinished {
+		tests[key].end("fail", last)
+	}
+	for _, pkg := range pkgs {
+		pkg.end("fail", last)
+	}
+}
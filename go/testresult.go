@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gomod/internal/dagger"
+)
+
+// TestResult is the outcome of a go test run, parsed from go test -json.
+type TestResult struct {
+	// The container that ran the tests. Unset for sharded runs.
+	Container *dagger.Container
+
+	// The raw go test -json event stream.
+	Report *dagger.File
+
+	// The exit code of go test.
+	ExitCode int
+
+	// Results for each package, in the order they were reported.
+	Packages []*PackageResult
+
+	// Coverage collected by the run, if enabled.
+	Coverage *CoverageReport
+}
+
+// PackageResult is the outcome of testing a single package.
+type PackageResult struct {
+	// The import path of the package.
+	Name string
+
+	// The status of the package: pass, fail, or skip.
+	Status string
+
+	// How long the package took to test, in seconds.
+	Elapsed float64
+
+	// Output printed outside of any test, e.g. build errors or the final
+	// ok/FAIL line.
+	Output string
+
+	// Results for each test in the package, including subtests.
+	Tests []*TestCase
+}
+
+// TestCase is the outcome of a single test or subtest.
+type TestCase struct {
+	// The import path of the package containing the test.
+	Package string
+
+	// The name of the test, e.g. TestFoo or TestFoo/bar.
+	Name string
+
+	// The status of the test: pass, fail, or skip.
+	Status string
+
+	// How long the test took, in seconds.
+	Elapsed float64
+
+	// Output printed by the test.
+	Output string
+
+	// How many times the test was run.
+	Attempts int
+
+	// Whether the test failed at first but passed when retried.
+	Flaky bool
+}
+
+// Failed returns all tests that failed.
+func (r *TestResult) Failed() []*TestCase {
+	var failed []*TestCase
+	for _, pkg := range r.Packages {
+		for _, test := range pkg.Tests {
+			if test.Status == "fail" {
+				failed = append(failed, test)
+			}
+		}
+	}
+	return failed
+}
+
+// Flaky returns all tests that failed at first but passed when retried.
+func (r *TestResult) Flaky() []*TestCase {
+	var flaky []*TestCase
+	for _, pkg := range r.Packages {
+		for _, test := range pkg.Tests {
+			if test.Flaky {
+				flaky = append(flaky, test)
+			}
+		}
+	}
+	return flaky
+}
+
+// FailedPackages returns all packages that failed, including packages that
+// failed to build.
+func (r *TestResult) FailedPackages() []*PackageResult {
+	var failed []*PackageResult
+	for _, pkg := range r.Packages {
+		if pkg.Status == "fail" {
+			failed = append(failed, pkg)
+		}
+	}
+	return failed
+}
+
+// Summary returns a human-readable summary of the test run.
+func (r *TestResult) Summary() string {
+	var passed, failed, skipped, flaky int
+	for _, pkg := range r.Packages {
+		for _, test := range pkg.Tests {
+			switch test.Status {
+			case "pass":
+				passed++
+			case "fail":
+				failed++
+			case "skip":
+				skipped++
+			}
+			if test.Flaky {
+				flaky++
+			}
+		}
+	}
+
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "%d passed, %d failed, %d skipped in %d packages\n",
+		passed, failed, skipped, len(r.Packages))
+	if flaky > 0 {
+		fmt.Fprintf(out, "%d passed only when retried:\n", flaky)
+		for _, test := range r.Flaky() {
+			fmt.Fprintf(out, "  %s %s (%d attempts)\n", test.Package, test.Name, test.Attempts)
+		}
+	}
+	for _, pkg := range r.FailedPackages() {
+		fmt.Fprintf(out, "\nFAIL %s\n", pkg.Name)
+		var failedTests bool
+		for _, test := range pkg.Tests {
+			if test.Status == "fail" {
+				fmt.Fprintf(out, "  --- FAIL: %s (%.2fs)\n", test.Name, test.Elapsed)
+				failedTests = true
+			}
+		}
+		if !failedTests && pkg.Output != "" {
+			// no test failed, so show the package output; it probably failed to
+			// build
+			fmt.Fprint(out, indent(pkg.Output, "  "))
+		}
+	}
+	return out.String()
+}
+
+// Check returns an error if any package failed, or if go test otherwise
+// exited non-zero, e.g. because go vet failed.
+func (r *TestResult) Check() error {
+	if len(r.FailedPackages()) > 0 {
+		return errors.New(r.Summary())
+	}
+	if r.ExitCode != 0 {
+		return fmt.Errorf("go test exited %d\n%s", r.ExitCode, r.Summary())
+	}
+	return nil
+}
+
+// testOpts configures a go test run.
+type testOpts struct {
+	Src                      *dagger.Directory
+	Subdir                   string
+	Packages                 []string
+	Verbose                  bool
+	Race                     bool
+	TestFlags                []string
+	InsecureRootCapabilities bool
+	Nest                     bool
+	Coverage                 bool
+
+	// The retry attempt, so that each retry really runs instead of hitting
+	// the cache.
+	Attempt int
+}
+
+// goTestCommand returns the go test -json command line for a run.
+func goTestCommand(opts testOpts) []string {
+	goTest := []string{"go", "test"}
+
+	// -C must come first
+	if opts.Subdir != "" {
+		goTest = append(goTest, "-C", opts.Subdir)
+	}
+
+	goTest = append(goTest, "-json")
+
+	if opts.Race {
+		goTest = append(goTest, "-race")
+	}
+
+	if opts.Verbose {
+		goTest = append(goTest, "-v")
+	}
+
+	if opts.Coverage {
+		goTest = append(goTest,
+			"-covermode=atomic",
+			"-coverpkg=./...",
+			"-coverprofile=/tmp/coverage/cover.out",
+		)
+	}
+
+	goTest = append(goTest, opts.TestFlags...)
+
+	pkgs := opts.Packages
+	if len(pkgs) == 0 {
+		pkgs = []string{"./..."}
+	}
+	return append(goTest, pkgs...)
+}
+
+// runTests runs go test -json and collects its results.
+func (g *Go) runTests(ctx context.Context, opts testOpts) (*TestResult, error) {
+	ctr := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		WithMountedDirectory("/src", opts.Src).
+		WithWorkdir("/src")
+
+	if opts.Coverage {
+		ctr = ctr.WithDirectory("/tmp/coverage", dag.Directory())
+	}
+
+	if opts.Attempt > 0 {
+		ctr = ctr.WithEnvVariable("RETRY_ATTEMPT", strconv.Itoa(opts.Attempt))
+	}
+
+	goTest := goTestCommand(opts)
+
+	ctr = ctr.WithExec(goTest, dagger.ContainerWithExecOpts{
+		RedirectStdout:                "/tmp/test.json",
+		InsecureRootCapabilities:      opts.InsecureRootCapabilities,
+		ExperimentalPrivilegedNesting: opts.Nest,
+		Expect:                        dagger.ReturnTypeAny,
+	})
+
+	exitCode, err := ctr.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := ctr.File("/tmp/test.json")
+	reportJSON, err := report.Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := parseTestEvents(strings.NewReader(reportJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	if exitCode != 0 && len(events) == 0 {
+		// go test failed before running anything, e.g. due to a bad flag
+		stderr, err := ctr.Stderr(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("go test exited %d:\n%s", exitCode, stderr)
+	}
+
+	emitTestSpans(ctx, events, opts.Attempt)
+
+	result := &TestResult{
+		Container: ctr,
+		Report:    report,
+		ExitCode:  exitCode,
+		Packages:  collectPackages(events),
+	}
+
+	if opts.Coverage {
+		profiles, err := ctr.Directory("/tmp/coverage").Entries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(profiles) > 0 {
+			result.Coverage, err = g.MergeCoverage(ctx, opts.Src, []*dagger.File{
+				ctr.File("/tmp/coverage/cover.out"),
+			}, opts.Subdir)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// testEvent is a single event emitted by go test -json.
+//
+// See go doc test2json for details.
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+
+	// Set on build-output events since Go 1.24, e.g. "foo [foo.test]".
+	ImportPath string
+
+	// Set on a package's fail event if it failed to build, naming the
+	// ImportPath of the build output.
+	FailedBuild string
+}
+
+// parseTestEvents decodes a go test -json event stream.
+func parseTestEvents(r io.Reader) ([]testEvent, error) {
+	var events []testEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			// go test may print non-JSON lines, e.g. for build failures prior
+			// to Go 1.24
+			continue
+		}
+		var event testEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("decode test event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// collectPackages folds test events into per-package and per-test results.
+func collectPackages(events []testEvent) []*PackageResult {
+	var pkgs []*PackageResult
+	pkgsByName := map[string]*PackageResult{}
+	testsByName := map[string]*TestCase{}
+
+	buildOutput := map[string]string{}
+
+	for _, event := range events {
+		if event.Action == "build-output" {
+			buildOutput[event.ImportPath] += event.Output
+			continue
+		}
+
+		if event.Package == "" {
+			continue
+		}
+
+		pkg, found := pkgsByName[event.Package]
+		if !found {
+			pkg = &PackageResult{Name: event.Package}
+			pkgsByName[event.Package] = pkg
+			pkgs = append(pkgs, pkg)
+		}
+
+		if event.Test == "" {
+			switch event.Action {
+			case "output":
+				pkg.Output += event.Output
+			case "pass", "fail", "skip":
+				pkg.Status = event.Action
+				pkg.Elapsed = event.Elapsed
+				if event.FailedBuild != "" {
+					// precede the FAIL line with the compiler errors
+					pkg.Output = buildOutput[event.FailedBuild] + pkg.Output
+				}
+			}
+			continue
+		}
+
+		key := event.Package + " " + event.Test
+		test, found := testsByName[key]
+		if !found {
+			test = &TestCase{
+				Package:  event.Package,
+				Name:     event.Test,
+				Attempts: 1,
+			}
+			testsByName[key] = test
+			pkg.Tests = append(pkg.Tests, test)
+		}
+
+		switch event.Action {
+		case "output":
+			test.Output += event.Output
+		case "pass", "fail", "skip":
+			test.Status = event.Action
+			test.Elapsed = event.Elapsed
+		}
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Status == "" {
+			// no terminal event, e.g. the test binary was killed
+			pkg.Status = "fail"
+		}
+		for _, test := range pkg.Tests {
+			if test.Status == "" && pkg.Status == "fail" {
+				// the test never finished, e.g. it panicked or timed out
+				test.Status = "fail"
+			}
+		}
+	}
+
+	return pkgs
+}
+
+func indent(text, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectPackagesBuildFailure(t *testing.T) {
+	// go test -json output for a package that fails to build, as of Go 1.24
+	events, err := parseTestEvents(strings.NewReader(`{"ImportPath":"example.com/broken [example.com/broken.test]","Action":"build-output","Output":"# example.com/broken\n"}
+{"ImportPath":"example.com/broken [example.com/broken.test]","Action":"build-output","Output":"./broken.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/broken [example.com/broken.test]","Action":"build-fail"}
+{"Action":"start","Package":"example.com/broken"}
+{"Action":"output","Package":"example.com/broken","Output":"FAIL\texample.com/broken [build failed]\n"}
+{"Action":"fail","Package":"example.com/broken","Elapsed":0,"FailedBuild":"example.com/broken [example.com/broken.test]"}
+{"Action":"start","Package":"example.com/ok"}
+{"Action":"run","Package":"example.com/ok","Test":"TestOK"}
+{"Action":"pass","Package":"example.com/ok","Test":"TestOK","Elapsed":0.01}
+{"Action":"pass","Package":"example.com/ok","Elapsed":0.02}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs := collectPackages(events)
+	if len(pkgs) != 2 {
+		t.Fatalf("got %d packages, want 2", len(pkgs))
+	}
+
+	broken := pkgs[0]
+	if broken.Name != "example.com/broken" || broken.Status != "fail" {
+		t.Errorf("got %s %s, want example.com/broken fail", broken.Name, broken.Status)
+	}
+	want := "# example.com/broken\n./broken.go:3:1: syntax error\nFAIL\texample.com/broken [build failed]\n"
+	if broken.Output != want {
+		t.Errorf("got output %q, want %q", broken.Output, want)
+	}
+
+	result := &TestResult{Packages: pkgs}
+	if summary := result.Summary(); !strings.Contains(summary, "syntax error") {
+		t.Errorf("summary does not include the build error:\n%s", summary)
+	}
+}
+
+func TestGoTestCommandSubdir(t *testing.T) {
+	cmd := goTestCommand(testOpts{Subdir: "sub", Verbose: true})
+	// go test rejects -C anywhere but first
+	want := "go test -C sub -json -v ./..."
+	if got := strings.Join(cmd, " "); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCheckExitCode(t *testing.T) {
+	// e.g. go vet failed, so no package reported a failure
+	result := &TestResult{ExitCode: 1}
+	if err := result.Check(); err == nil {
+		t.Error("got no error for a non-zero exit code")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/version"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// CheckVersion returns an error if the base container's Go version does not
+// satisfy the go directive in the given module's go.mod.
+func (g *Go) CheckVersion(
+	ctx context.Context,
+	// The directory containing the go.mod file.
+	src *dagger.Directory,
+) error {
+	content, err := src.File("go.mod").Contents(ctx)
+	if err != nil {
+		return err
+	}
+	required, _ := parseGoMod(content)
+	if required == "" {
+		return nil
+	}
+
+	out, err := g.Base.
+		WithEnvVariable("GOTOOLCHAIN", "local").
+		WithExec([]string{"go", "env", "GOVERSION"}).
+		Stdout(ctx)
+	if err != nil {
+		return err
+	}
+	have := strings.TrimSpace(out)
+	if !version.IsValid(have) {
+		// e.g. a development build; nothing to compare against
+		return nil
+	}
+
+	if version.Compare(have, "go"+required) < 0 {
+		return fmt.Errorf("base image has %s, but go.mod requires go %s", have, required)
+	}
+	return nil
+}
+
+// goModVersion returns the Go version to use for the module in the given
+// directory, preferring the toolchain directive over the go directive.
+func goModVersion(ctx context.Context, src *dagger.Directory) (string, error) {
+	content, err := src.File("go.mod").Contents(ctx)
+	if err != nil {
+		return "", err
+	}
+	goVersion, toolchain := parseGoMod(content)
+	if toolchain != "" {
+		return toolchain, nil
+	}
+	return goVersion, nil
+}
+
+// parseGoMod returns the versions named by the go and toolchain directives,
+// without the go prefix.
+func parseGoMod(content string) (goVersion, toolchain string) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "go":
+			goVersion = fields[1]
+		case "toolchain":
+			if fields[1] != "default" {
+				toolchain = strings.TrimPrefix(fields[1], "go")
+			}
+		}
+	}
+	return goVersion, toolchain
+}
+
+// goImage returns a container setup for the given Go version and image
+// variant.
+func goImage(goVersion, variant string) (dagger.WithContainerFunc, error) {
+	switch variant {
+	case "", "debian":
+		return func(ctr *dagger.Container) *dagger.Container {
+			return ctr.From("golang:" + goVersion)
+		}, nil
+	case "alpine":
+		return func(ctr *dagger.Container) *dagger.Container {
+			return ctr.From("golang:" + goVersion + "-alpine")
+		}, nil
+	case "distroless":
+		// distroless images are based on Debian 12, so build against the same
+		// libc for cgo binaries to run on e.g. gcr.io/distroless/base-debian12
+		return func(ctr *dagger.Container) *dagger.Container {
+			return ctr.From("golang:" + goVersion + "-bookworm")
+		}, nil
+	case "wolfi":
+		pkg := wolfiGoPackage(goVersion)
+		return func(ctr *dagger.Container) *dagger.Container {
+			return ctr.
+				From("cgr.dev/chainguard/wolfi-base").
+				WithExec([]string{"apk", "add", "--no-cache", pkg, "git"})
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown variant %q: must be debian, alpine, distroless, or wolfi", variant)
+	}
+}
+
+// wolfiGoPackage returns the apk package spec for a Go version. Wolfi
+// packages Go by minor version, e.g. go-1.23, so a patch version is pinned
+// with a fuzzy version constraint, e.g. go-1.23~1.23.2.
+func wolfiGoPackage(goVersion string) string {
+	parts := strings.Split(goVersion, ".")
+	if len(parts) < 2 {
+		return "go"
+	}
+	pkg := "go-" + parts[0] + "." + parts[1]
+	if len(parts) > 2 {
+		pkg += "~" + goVersion
+	}
+	return pkg
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gomod/internal/dagger"
+)
+
+// VulncheckReport is the outcome of a govulncheck scan.
+type VulncheckReport struct {
+	// The raw govulncheck -format json output.
+	Report *dagger.File
+
+	// Vulnerabilities found, one per advisory and module.
+	Findings []*Vulnerability
+}
+
+// Vulnerability is a known vulnerability affecting a module.
+type Vulnerability struct {
+	// The OSV ID of the advisory, e.g. GO-2023-1234.
+	ID string
+
+	// Other IDs for the advisory, e.g. CVE or GHSA IDs.
+	Aliases []string
+
+	// A short description of the vulnerability.
+	Summary string
+
+	// The affected module.
+	Module string
+
+	// The version of the module in use.
+	Version string
+
+	// The earliest version of the module that fixes the vulnerability, if any.
+	FixedVersion string
+
+	// How the vulnerability is reachable: symbol if vulnerable code is
+	// called, package if a vulnerable package is imported, or module if a
+	// vulnerable module is merely required.
+	Level string
+
+	// Vulnerable symbols that are called, if any.
+	Symbols []string
+}
+
+// vulnLevels orders reachability levels from least to most severe.
+var vulnLevels = []string{"module", "package", "symbol"}
+
+// Vulncheck scans for known vulnerabilities using govulncheck.
+//
+// govulncheck is installed unless the base container already has it. To scan
+// offline, either use a base with govulncheck installed or configure
+// WithGoProxy with a directory that contains the pinned version, and pass db.
+func (g *Go) Vulncheck(
+	ctx context.Context,
+	// The directory containing code to scan.
+	src *dagger.Directory,
+	// Subdirectory containing the Go module.
+	// +optional
+	subdir string,
+	// Packages to scan.
+	// +optional
+	packages []string,
+	// The version of govulncheck to install.
+	// +optional
+	// +default="v1.1.4"
+	version string,
+	// A local copy of the vulnerability database, for scanning offline.
+	// +optional
+	db *dagger.Directory,
+	// Fail if any vulnerability is reachable at or above this level: symbol,
+	// package, or module. By default the scan never fails.
+	// +optional
+	failOn string,
+) (*VulncheckReport, error) {
+	if failOn != "" && !slices.Contains(vulnLevels, failOn) {
+		return nil, fmt.Errorf("invalid failOn level %q: must be one of %s", failOn, strings.Join(vulnLevels, ", "))
+	}
+
+	pkgs := packages
+	if len(pkgs) == 0 {
+		pkgs = []string{"./..."}
+	}
+
+	ctr := g.Base.
+		With(g.GlobalCache).
+		With(g.PrivateModules).
+		With(g.BinPath).
+		WithEnvVariable("GOVULNCHECK_VERSION", version).
+		WithExec([]string{"sh", "-c",
+			`command -v govulncheck >/dev/null || go install golang.org/x/vuln/cmd/govulncheck@"$GOVULNCHECK_VERSION"`}).
+		With(Cd("/src", src))
+
+	cmd := []string{"govulncheck", "-format", "json"}
+	if subdir != "" {
+		cmd = append(cmd, "-C", subdir)
+	}
+	if db != nil {
+		ctr = ctr.WithMountedDirectory("/vulndb", db)
+		cmd = append(cmd, "-db", "file:///vulndb")
+	}
+	cmd = append(cmd, pkgs...)
+
+	report := ctr.
+		WithExec(cmd, dagger.ContainerWithExecOpts{
+			RedirectStdout: "/tmp/vulncheck.json",
+		}).
+		File("/tmp/vulncheck.json")
+
+	content, err := report.Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := parseVulncheck(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if failOn != "" {
+		threshold := slices.Index(vulnLevels, failOn)
+		var errs []error
+		for _, vuln := range findings {
+			if slices.Index(vulnLevels, vuln.Level) >= threshold {
+				errs = append(errs, errors.New(vuln.describe()))
+			}
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%d vulnerabilities reachable at %s level or above:\n%w",
+				len(errs), failOn, errors.Join(errs...))
+		}
+	}
+
+	return &VulncheckReport{
+		Report:   report,
+		Findings: findings,
+	}, nil
+}
+
+// describe returns a one-line description of the vulnerability.
+func (v *Vulnerability) describe() string {
+	desc := fmt.Sprintf("%s: %s@%s", v.ID, v.Module, v.Version)
+	if v.FixedVersion != "" {
+		desc += " (fixed in " + v.FixedVersion + ")"
+	}
+	if len(v.Symbols) > 0 {
+		desc += " via " + strings.Join(v.Symbols, ", ")
+	}
+	if v.Summary != "" {
+		desc += ": " + v.Summary
+	}
+	return desc
+}
+
+// vulncheckMessage is a single message emitted by govulncheck -format json.
+type vulncheckMessage struct {
+	OSV *struct {
+		ID      string   `json:"id"`
+		Aliases []string `json:"aliases"`
+		Summary string   `json:"summary"`
+	} `json:"osv"`
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module   string `json:"module"`
+			Version  string `json:"version"`
+			Package  string `json:"package"`
+			Function string `json:"function"`
+			Receiver string `json:"receiver"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// parseVulncheck folds govulncheck findings into one vulnerability per
+// advisory and module.
+func parseVulncheck(r io.Reader) ([]*Vulnerability, error) {
+	var vulns []*Vulnerability
+	byKey := map[string]*Vulnerability{}
+	type advisory struct {
+		aliases []string
+		summary string
+	}
+	advisories := map[string]advisory{}
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg vulncheckMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode govulncheck output: %w", err)
+		}
+
+		if msg.OSV != nil {
+			advisories[msg.OSV.ID] = advisory{
+				aliases: msg.OSV.Aliases,
+				summary: msg.OSV.Summary,
+			}
+		}
+
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+
+		// the first frame is the vulnerable symbol, package, or module
+		frame := msg.Finding.Trace[0]
+
+		key := msg.Finding.OSV + " " + frame.Module
+		vuln, found := byKey[key]
+		if !found {
+			vuln = &Vulnerability{
+				ID:           msg.Finding.OSV,
+				Module:       frame.Module,
+				Version:      frame.Version,
+				FixedVersion: msg.Finding.FixedVersion,
+				Level:        "module",
+			}
+			byKey[key] = vuln
+			vulns = append(vulns, vuln)
+		}
+
+		level := "module"
+		switch {
+		case frame.Function != "":
+			level = "symbol"
+			symbol := frame.Package + "." + frame.Function
+			if frame.Receiver != "" {
+				symbol = frame.Package + "." + strings.TrimPrefix(frame.Receiver, "*") + "." + frame.Function
+			}
+			if !slices.Contains(vuln.Symbols, symbol) {
+				vuln.Symbols = append(vuln.Symbols, symbol)
+			}
+		case frame.Package != "":
+			level = "package"
+		}
+		if slices.Index(vulnLevels, level) > slices.Index(vulnLevels, vuln.Level) {
+			vuln.Level = level
+		}
+	}
+
+	for _, vuln := range vulns {
+		adv := advisories[vuln.ID]
+		vuln.Aliases = adv.aliases
+		vuln.Summary = adv.summary
+	}
+
+	return vulns, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"gomod/internal/dagger"
+)
+
+// Workspace is a repository containing multiple Go modules.
+type Workspace struct {
+	// +private
+	Go *Go
+
+	// The repository source.
+	Src *dagger.Directory
+
+	// The modules in the workspace.
+	Modules []*Module
+}
+
+// Module is a Go module within a workspace.
+type Module struct {
+	// The module path, as declared in go.mod.
+	Path string
+
+	// The directory containing the module, relative to the workspace root.
+	Dir string
+}
+
+// ModuleTestResult is the outcome of testing a single module.
+type ModuleTestResult struct {
+	// The module path.
+	Path string
+
+	// The directory containing the module.
+	Dir string
+
+	// The test results.
+	Result *TestResult
+}
+
+// ModuleLintResult is the outcome of linting a single module.
+type ModuleLintResult struct {
+	// The module path.
+	Path string
+
+	// The directory containing the module.
+	Dir string
+
+	// The lint results.
+	Result *LintResult
+}
+
+// Workspace discovers the Go modules in a repository.
+//
+// If the repository has a go.work file, its use directives determine the
+// modules; otherwise every directory containing a go.mod file is a module.
+func (g *Go) Workspace(
+	ctx context.Context,
+	// The repository source.
+	src *dagger.Directory,
+) (*Workspace, error) {
+	dirs, err := g.moduleDirs(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &Workspace{
+		Go:  g,
+		Src: src,
+	}
+	for _, dir := range dirs {
+		goMod, err := src.File(path.Join(dir, "go.mod")).Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ws.Modules = append(ws.Modules, &Module{
+			Path: parseModulePath(goMod),
+			Dir:  dir,
+		})
+	}
+	return ws, nil
+}
+
+// moduleDirs returns the directories containing modules, relative to the
+// root of the source.
+func (g *Go) moduleDirs(ctx context.Context, src *dagger.Directory) ([]string, error) {
+	goWork, err := src.Glob(ctx, "go.work")
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	if len(goWork) > 0 {
+		out, err := g.Base.
+			With(Cd("/src", src)).
+			WithExec([]string{"go", "work", "edit", "-json"}).
+			Stdout(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var work struct {
+			Use []struct {
+				DiskPath string
+			}
+		}
+		if err := json.Unmarshal([]byte(out), &work); err != nil {
+			return nil, err
+		}
+		for _, use := range work.Use {
+			dirs = append(dirs, path.Clean(use.DiskPath))
+		}
+	} else {
+		goMods, err := src.Glob(ctx, "**/go.mod")
+		if err != nil {
+			return nil, err
+		}
+		for _, goMod := range goMods {
+			dir := path.Dir(goMod)
+			if isIgnoredDir(dir) {
+				continue
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// isIgnoredDir reports whether the go command ignores a directory, e.g.
+// testdata or vendor.
+func isIgnoredDir(dir string) bool {
+	if dir == "." {
+		return false
+	}
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "testdata" || elem == "vendor" ||
+			strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseModulePath returns the path declared by a go.mod file's module
+// directive.
+func parseModulePath(goMod string) string {
+	for _, line := range strings.Split(goMod, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// Test runs the tests of each module in parallel.
+func (w *Workspace) Test(
+	ctx context.Context,
+	// Run with -v.
+	// +optional
+	verbose bool,
+	// Whether to run tests with race detection.
+	// +optional
+	race bool,
+	// Arbitrary flags to pass along to go test.
+	// +optional
+	testFlags []string,
+	// Whether to run tests insecurely, i.e. with special privileges.
+	// +optional
+	insecureRootCapabilities bool,
+	// Enable experimental Dagger nesting.
+	// +optional
+	nest bool,
+	// Collect a coverage profile across all packages.
+	// +optional
+	coverage bool,
+) ([]*ModuleTestResult, error) {
+	results := make([]*ModuleTestResult, len(w.Modules))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, mod := range w.Modules {
+		eg.Go(func() error {
+			result, err := w.Go.runTests(ctx, testOpts{
+				Src:                      w.Src,
+				Subdir:                   mod.Dir,
+				Verbose:                  verbose,
+				Race:                     race,
+				TestFlags:                testFlags,
+				InsecureRootCapabilities: insecureRootCapabilities,
+				Nest:                     nest,
+				Coverage:                 coverage,
+			})
+			if err != nil {
+				return err
+			}
+			results[i] = &ModuleTestResult{
+				Path:   mod.Path,
+				Dir:    mod.Dir,
+				Result: result,
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Build builds each module, placing each module's artifacts in a
+// subdirectory named after the module's directory.
+func (w *Workspace) Build(
+	ctx context.Context,
+	// Packages to build, relative to each module.
+	// +optional
+	packages []string,
+	// -X definitions to pass to go build -ldflags.
+	// +optional
+	xDefs []string,
+	// Whether to enable CGO.
+	// +optional
+	static bool,
+	// GOOS to pass to go build for cross-compilation.
+	// +optional
+	GOOS string,
+	// GOARCH to pass to go build. for cross-compilation
+	// +optional
+	GOARCH string,
+	// Arbitrary flags to pass along to go build.
+	// +optional
+	buildFlags []string,
+) (*dagger.Directory, error) {
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	out := dag.Directory()
+	for _, mod := range w.Modules {
+		// -C must come first, so prepend it to the build flags
+		flags := append([]string{"-C", mod.Dir}, buildFlags...)
+		bins, err := w.Go.Build(ctx, w.Src, packages, mod.Dir, xDefs, static, false, GOOS, GOARCH, flags, false, false)
+		if err != nil {
+			return nil, err
+		}
+		out = out.WithDirectory("/", bins)
+	}
+	return out, nil
+}
+
+// GolangCILint lints each module in parallel.
+func (w *Workspace) GolangCILint(
+	ctx context.Context,
+	// +optional
+	verbose bool,
+	// +optional
+	timeoutInSeconds int,
+	// The version of golangci-lint to install.
+	// +optional
+	// +default="v1.64.8"
+	version string,
+) ([]*ModuleLintResult, error) {
+	results := make([]*ModuleLintResult, len(w.Modules))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, mod := range w.Modules {
+		eg.Go(func() error {
+			result, err := w.Go.GolangCILint(ctx, w.Src, mod.Dir, verbose, timeoutInSeconds, version, false)
+			if err != nil {
+				return err
+			}
+			results[i] = &ModuleLintResult{
+				Path:   mod.Path,
+				Dir:    mod.Dir,
+				Result: result,
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Generate runs go generate ./... in each module and returns the updated
+// source.
+func (w *Workspace) Generate() *dagger.Directory {
+	out := w.Src
+	for _, mod := range w.Modules {
+		generated := w.Go.Generate(w.Src, mod.Dir)
+		out = out.WithDirectory(mod.Dir, generated.Directory(mod.Dir))
+	}
+	return out
+}
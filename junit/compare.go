@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"dagger/junit/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// Comparison is the difference between two sets of test results.
+type Comparison struct {
+	// Tests that passed in the baseline but fail now.
+	NewlyFailing []*TestDiff
+
+	// Tests that failed in the baseline but pass now.
+	NewlyPassing []*TestDiff
+
+	// Tests that are not in the baseline.
+	Added []*TestCase
+
+	// Tests that are in the baseline but no longer reported.
+	Removed []*TestCase
+
+	// Tests that got significantly slower than the baseline.
+	Slower []*TestDiff
+}
+
+// TestDiff is a test reported in both the baseline and the current results.
+type TestDiff struct {
+	// The test in the baseline.
+	Before *TestCase
+
+	// The test in the current results.
+	After *TestCase
+}
+
+// Compare compares the current test results against a baseline.
+//
+// Both sets of reports are merged first, so sharded and retried runs compare
+// by each test's last result.
+func (m *Junit) Compare(
+	ctx context.Context,
+	// JUnit XML reports from the baseline run.
+	baseline *dagger.Directory,
+	// JUnit XML reports from the current run.
+	current *dagger.Directory,
+	// How much slower a test must get to be reported, as a percentage.
+	// +optional
+	// +default=50
+	threshold int,
+	// How much slower a test must get to be reported, in seconds, so that
+	// small changes to fast tests are ignored.
+	// +optional
+	// +default=1
+	minDelta float64,
+) (*Comparison, error) {
+	before, err := m.ParseAll(ctx, baseline)
+	if err != nil {
+		return nil, err
+	}
+	after, err := m.ParseAll(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+
+	beforeAll := before.dedupe().Tests()
+	beforeTests := map[string]*TestCase{}
+	for _, test := range beforeAll {
+		beforeTests[test.key()] = test
+	}
+
+	cmp := &Comparison{}
+	seen := map[string]bool{}
+	for _, test := range after.dedupe().Tests() {
+		key := test.key()
+		seen[key] = true
+
+		prev, found := beforeTests[key]
+		if !found {
+			cmp.Added = append(cmp.Added, test)
+			continue
+		}
+
+		diff := &TestDiff{Before: prev, After: test}
+		switch {
+		case !prev.failed() && test.failed():
+			cmp.NewlyFailing = append(cmp.NewlyFailing, diff)
+		case prev.failed() && !test.failed():
+			cmp.NewlyPassing = append(cmp.NewlyPassing, diff)
+		}
+
+		delta := test.Duration - prev.Duration
+		if delta >= minDelta && delta > prev.Duration*float64(threshold)/100 {
+			cmp.Slower = append(cmp.Slower, diff)
+		}
+	}
+
+	for _, test := range beforeAll {
+		if !seen[test.key()] {
+			cmp.Removed = append(cmp.Removed, test)
+		}
+	}
+
+	return cmp, nil
+}
+
+// Summary returns a human-readable summary of the comparison.
+func (c *Comparison) Summary() string {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "%d newly failing, %d newly passing, %d added, %d removed, %d slower\n",
+		len(c.NewlyFailing), len(c.NewlyPassing), len(c.Added), len(c.Removed), len(c.Slower))
+	for _, diff := range c.NewlyFailing {
+		fmt.Fprintf(out, "  FAIL %s\n", diff.After.describe())
+	}
+	for _, diff := range c.Slower {
+		fmt.Fprintf(out, "  SLOW %s (%.2fs -> %.2fs)\n",
+			diff.After.describe(), diff.Before.Duration, diff.After.Duration)
+	}
+	return out.String()
+}
+
+func (t *TestCase) failed() bool {
+	return t.Status == "failed" || t.Status == "error"
+}
+
+// describe identifies the test for humans.
+func (t *TestCase) describe() string {
+	if t.Classname != "" {
+		return t.Classname + "." + t.Name
+	}
+	return t.Suite + " " + t.Name
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ctrfReport is a Common Test Report Format JSON report.
+type ctrfReport struct {
+	Results struct {
+		Tool struct {
+			Name string `json:"name"`
+		} `json:"tool"`
+		Summary struct {
+			// milliseconds since the epoch
+			Start int64 `json:"start"`
+		} `json:"summary"`
+		Tests []struct {
+			Name     string   `json:"name"`
+			Status   string   `json:"status"`
+			Duration float64  `json:"duration"`
+			Message  string   `json:"message"`
+			Trace    string   `json:"trace"`
+			Suite    string   `json:"suite"`
+			FilePath string   `json:"filePath"`
+			Stdout   []string `json:"stdout"`
+			Stderr   []string `json:"stderr"`
+		} `json:"tests"`
+	} `json:"results"`
+}
+
+// parseCTRF parses a CTRF JSON report, with a suite per test suite or file.
+func parseCTRF(name, content string) (*Results, error) {
+	var report ctrfReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, err
+	}
+
+	var timestamp string
+	if start := report.Results.Summary.Start; start > 0 {
+		timestamp = time.UnixMilli(start).UTC().Format(time.RFC3339Nano)
+	}
+
+	results := &Results{}
+	suites := map[string]*Suite{}
+	for _, t := range report.Results.Tests {
+		suiteName := t.Suite
+		if suiteName == "" {
+			suiteName = t.FilePath
+		}
+		if suiteName == "" {
+			suiteName = report.Results.Tool.Name
+		}
+		if suiteName == "" {
+			suiteName = reportName(name)
+		}
+		suite, found := suites[suiteName]
+		if !found {
+			suite = &Suite{
+				Name:      suiteName,
+				Timestamp: timestamp,
+			}
+			suites[suiteName] = suite
+			results.Suites = append(results.Suites, suite)
+		}
+
+		test := &TestCase{
+			Suite:     suite.Name,
+			Name:      t.Name,
+			Classname: t.FilePath,
+			Duration:  t.Duration / 1000,
+			Message:   t.Message,
+			Details:   t.Trace,
+			SystemOut: joinLines(t.Stdout),
+			SystemErr: joinLines(t.Stderr),
+		}
+		switch t.Status {
+		case "passed", "failed":
+			test.Status = t.Status
+		default:
+			// skipped, pending, or other
+			test.Status = "skipped"
+		}
+		suite.Tests = append(suite.Tests, test)
+	}
+
+	for _, suite := range results.Suites {
+		suite.Totals = totals(suite.Tests)
+	}
+	return results, nil
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
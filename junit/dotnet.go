@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// xunitAssemblies is an xUnit.net v2 XML report.
+type xunitAssemblies struct {
+	Assemblies []xunitAssembly `xml:"assembly"`
+}
+
+type xunitAssembly struct {
+	Name        string            `xml:"name,attr"`
+	RunDate     string            `xml:"run-date,attr"`
+	RunTime     string            `xml:"run-time,attr"`
+	Collections []xunitCollection `xml:"collection"`
+}
+
+type xunitCollection struct {
+	Name  string      `xml:"name,attr"`
+	Tests []xunitTest `xml:"test"`
+}
+
+type xunitTest struct {
+	Name    string  `xml:"name,attr"`
+	Type    string  `xml:"type,attr"`
+	Time    float64 `xml:"time,attr"`
+	Result  string  `xml:"result,attr"`
+	Output  string  `xml:"output"`
+	Reason  string  `xml:"reason"`
+	Failure *struct {
+		Message    string `xml:"message"`
+		StackTrace string `xml:"stack-trace"`
+	} `xml:"failure"`
+}
+
+// parseXUnit parses an xUnit.net v2 XML report, with a suite per test
+// collection.
+func parseXUnit(content string) (*Results, error) {
+	var doc xunitAssemblies
+	if rootElement(content) == "assembly" {
+		var assembly xunitAssembly
+		if err := xml.Unmarshal([]byte(content), &assembly); err != nil {
+			return nil, err
+		}
+		doc.Assemblies = append(doc.Assemblies, assembly)
+	} else if err := xml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+
+	results := &Results{}
+	for _, assembly := range doc.Assemblies {
+		var timestamp string
+		if assembly.RunDate != "" && assembly.RunTime != "" {
+			timestamp = assembly.RunDate + "T" + assembly.RunTime
+		}
+		for _, collection := range assembly.Collections {
+			suite := &Suite{
+				Name:      collection.Name,
+				Package:   assembly.Name,
+				Timestamp: timestamp,
+			}
+			for _, t := range collection.Tests {
+				test := &TestCase{
+					Suite:     suite.Name,
+					Name:      t.Name,
+					Classname: t.Type,
+					Duration:  t.Time,
+					SystemOut: t.Output,
+				}
+				switch t.Result {
+				case "Pass":
+					test.Status = "passed"
+				case "Fail":
+					test.Status = "failed"
+				default:
+					test.Status = "skipped"
+					test.Message = strings.TrimSpace(t.Reason)
+				}
+				if t.Failure != nil {
+					test.Message = strings.TrimSpace(t.Failure.Message)
+					test.Details = t.Failure.StackTrace
+				}
+				suite.Tests = append(suite.Tests, test)
+			}
+			suite.Totals = totals(suite.Tests)
+			results.Suites = append(results.Suites, suite)
+		}
+	}
+	return results, nil
+}
+
+// nunitSuite is a test-suite element of an NUnit 2 or 3 XML report. NUnit 2
+// nests children in a results element.
+type nunitSuite struct {
+	Type      string       `xml:"type,attr"`
+	Name      string       `xml:"name,attr"`
+	FullName  string       `xml:"fullname,attr"`
+	StartTime string       `xml:"start-time,attr"`
+	Suites    []nunitSuite `xml:"test-suite"`
+	Cases     []nunitCase  `xml:"test-case"`
+	Suites2   []nunitSuite `xml:"results>test-suite"`
+	Cases2    []nunitCase  `xml:"results>test-case"`
+}
+
+type nunitCase struct {
+	Name      string  `xml:"name,attr"`
+	ClassName string  `xml:"classname,attr"`
+	Result    string  `xml:"result,attr"`
+	Label     string  `xml:"label,attr"`
+	Executed  string  `xml:"executed,attr"`
+	Duration  float64 `xml:"duration,attr"`
+	Time      float64 `xml:"time,attr"`
+	Output    string  `xml:"output"`
+	Failure   *struct {
+		Message    string `xml:"message"`
+		StackTrace string `xml:"stack-trace"`
+	} `xml:"failure"`
+	Reason string `xml:"reason>message"`
+}
+
+// parseNUnit parses an NUnit 2 or 3 XML report, with a suite per test suite
+// that directly contains test cases, e.g. a fixture.
+func parseNUnit(content string) (*Results, error) {
+	var doc struct {
+		Date   string       `xml:"date,attr"`
+		Time   string       `xml:"time,attr"`
+		Suites []nunitSuite `xml:"test-suite"`
+	}
+	if err := xml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+
+	// NUnit 2 only records when the whole run started
+	var runTimestamp string
+	if doc.Date != "" && doc.Time != "" {
+		runTimestamp = doc.Date + "T" + doc.Time
+	}
+
+	results := &Results{}
+	var walk func(s nunitSuite)
+	walk = func(s nunitSuite) {
+		cases := append(s.Cases, s.Cases2...)
+		if len(cases) > 0 {
+			suite := &Suite{
+				Name:      s.FullName,
+				Timestamp: s.StartTime,
+			}
+			if suite.Name == "" {
+				suite.Name = s.Name
+			}
+			if suite.Timestamp == "" {
+				suite.Timestamp = runTimestamp
+			}
+			for _, c := range cases {
+				test := &TestCase{
+					Suite:     suite.Name,
+					Name:      c.Name,
+					Classname: c.ClassName,
+					Duration:  c.Duration + c.Time,
+					Status:    nunitStatus(c),
+					SystemOut: c.Output,
+				}
+				if c.Failure != nil {
+					test.Message = strings.TrimSpace(c.Failure.Message)
+					test.Details = c.Failure.StackTrace
+				} else {
+					test.Message = strings.TrimSpace(c.Reason)
+				}
+				suite.Tests = append(suite.Tests, test)
+			}
+			suite.Totals = totals(suite.Tests)
+			results.Suites = append(results.Suites, suite)
+		}
+		for _, child := range append(s.Suites, s.Suites2...) {
+			walk(child)
+		}
+	}
+	for _, s := range doc.Suites {
+		walk(s)
+	}
+	return results, nil
+}
+
+// nunitStatus normalizes an NUnit 2 or 3 test result.
+func nunitStatus(c nunitCase) string {
+	if c.Executed == "False" {
+		return "skipped"
+	}
+	switch c.Result {
+	case "Passed", "Success":
+		return "passed"
+	case "Failed", "Failure":
+		if c.Label == "Error" {
+			return "error"
+		}
+		return "failed"
+	case "Error":
+		return "error"
+	default:
+		return "skipped"
+	}
+}
+
+// trxRun is a Visual Studio TRX report.
+type trxRun struct {
+	Times struct {
+		Start string `xml:"start,attr"`
+	} `xml:"Times"`
+	Results []struct {
+		TestID    string `xml:"testId,attr"`
+		TestName  string `xml:"testName,attr"`
+		Outcome   string `xml:"outcome,attr"`
+		Duration  string `xml:"duration,attr"`
+		StartTime string `xml:"startTime,attr"`
+		Output    struct {
+			StdOut    string `xml:"StdOut"`
+			StdErr    string `xml:"StdErr"`
+			ErrorInfo struct {
+				Message    string `xml:"Message"`
+				StackTrace string `xml:"StackTrace"`
+			} `xml:"ErrorInfo"`
+		} `xml:"Output"`
+	} `xml:"Results>UnitTestResult"`
+	Definitions []struct {
+		ID     string `xml:"id,attr"`
+		Method struct {
+			ClassName string `xml:"className,attr"`
+		} `xml:"TestMethod"`
+	} `xml:"TestDefinitions>UnitTest"`
+}
+
+// parseTRX parses a TRX report, with a suite per test class.
+func parseTRX(name, content string) (*Results, error) {
+	var run trxRun
+	if err := xml.Unmarshal([]byte(content), &run); err != nil {
+		return nil, err
+	}
+
+	classes := map[string]string{}
+	for _, def := range run.Definitions {
+		classes[def.ID] = def.Method.ClassName
+	}
+
+	results := &Results{}
+	suites := map[string]*Suite{}
+	for _, r := range run.Results {
+		class := classes[r.TestID]
+		suiteName := class
+		if suiteName == "" {
+			suiteName = reportName(name)
+		}
+		suite, found := suites[suiteName]
+		if !found {
+			suite = &Suite{
+				Name:      suiteName,
+				Timestamp: r.StartTime,
+			}
+			if suite.Timestamp == "" {
+				suite.Timestamp = run.Times.Start
+			}
+			suites[suiteName] = suite
+			results.Suites = append(results.Suites, suite)
+		}
+
+		test := &TestCase{
+			Suite:     suite.Name,
+			Name:      r.TestName,
+			Classname: class,
+			Duration:  trxDuration(r.Duration),
+			Message:   strings.TrimSpace(r.Output.ErrorInfo.Message),
+			Details:   r.Output.ErrorInfo.StackTrace,
+			SystemOut: r.Output.StdOut,
+			SystemErr: r.Output.StdErr,
+		}
+		switch r.Outcome {
+		case "Passed", "PassedButRunAborted":
+			test.Status = "passed"
+		case "Failed":
+			test.Status = "failed"
+		case "Error", "Timeout", "Aborted":
+			test.Status = "error"
+		default:
+			test.Status = "skipped"
+		}
+		suite.Tests = append(suite.Tests, test)
+	}
+
+	for _, suite := range results.Suites {
+		suite.Totals = totals(suite.Tests)
+	}
+	return results, nil
+}
+
+// trxDuration parses a TRX duration, e.g. 00:00:01.2345678, in seconds.
+func trxDuration(duration string) float64 {
+	var seconds float64
+	for _, part := range strings.Split(duration, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds
+}
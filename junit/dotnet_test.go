@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestParseNUnit(t *testing.T) {
+	results, err := parseNUnit(`<test-run>
+  <test-suite type="Assembly" name="Calc.Tests.dll">
+    <test-suite type="TestFixture" name="MathTests" fullname="Calc.Tests.MathTests">
+      <test-case name="Adds" result="Passed" duration="0.012" />
+      <test-case name="Divides" result="Failed" label="Error">
+        <failure><message> divide by zero </message></failure>
+      </test-case>
+      <test-case name="Ignored" result="Skipped">
+        <reason><message>not yet</message></reason>
+      </test-case>
+    </test-suite>
+  </test-suite>
+</test-run>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the fixture directly contains tests
+	if len(results.Suites) != 1 || results.Suites[0].Name != "Calc.Tests.MathTests" {
+		t.Fatalf("got %d suites, want only the fixture", len(results.Suites))
+	}
+	tests := results.Suites[0].Tests
+	if len(tests) != 3 {
+		t.Fatalf("got %d tests, want 3", len(tests))
+	}
+	if tests[1].Status != "error" || tests[1].Message != "divide by zero" {
+		t.Errorf("got %s %q, want an error with its message", tests[1].Status, tests[1].Message)
+	}
+	if tests[2].Status != "skipped" || tests[2].Message != "not yet" {
+		t.Errorf("got %s %q, want skipped with the reason", tests[2].Status, tests[2].Message)
+	}
+}
+
+func TestParseTRX(t *testing.T) {
+	results, err := parseTRX("results/Calc.trx", `<TestRun xmlns="http://microsoft.com/schemas/VisualStudio/TeamTest/2010">
+  <Results>
+    <UnitTestResult testId="a" testName="Divides" outcome="Failed" duration="00:01:02.5" />
+    <UnitTestResult testId="b" testName="Orphan" outcome="Timeout" />
+  </Results>
+  <TestDefinitions>
+    <UnitTest id="a"><TestMethod className="Calc.Tests.MathTests" /></UnitTest>
+  </TestDefinitions>
+</TestRun>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tests without a definition are grouped under the report's name
+	if len(results.Suites) != 2 || results.Suites[0].Name != "Calc.Tests.MathTests" || results.Suites[1].Name != "Calc" {
+		t.Fatalf("got %d suites, want the test class and Calc", len(results.Suites))
+	}
+	if test := results.Suites[0].Tests[0]; test.Status != "failed" || test.Duration != 62.5 {
+		t.Errorf("got %s in %gs, want failed in 62.5s", test.Status, test.Duration)
+	}
+	if test := results.Suites[1].Tests[0]; test.Status != "error" {
+		t.Errorf("got %s, want a timeout to be an error", test.Status)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/joshdk/go-junit"
+)
+
+// Supported report formats.
+const (
+	formatJUnit  = "junit"
+	formatTAP    = "tap"
+	formatGoTest = "gotest"
+	formatXUnit  = "xunit"
+	formatNUnit  = "nunit"
+	formatTRX    = "trx"
+	formatCTRF   = "ctrf"
+)
+
+// detectFormat determines the format of a report from its contents, returning
+// an empty string if it isn't a supported format.
+func detectFormat(content string) string {
+	trimmed := strings.TrimSpace(content)
+	switch {
+	case strings.HasPrefix(trimmed, "<"):
+		switch rootElement(trimmed) {
+		case "testsuites", "testsuite":
+			return formatJUnit
+		case "assemblies", "assembly":
+			return formatXUnit
+		case "test-run", "test-results":
+			return formatNUnit
+		case "TestRun":
+			return formatTRX
+		}
+	case strings.HasPrefix(trimmed, "{"):
+		firstLine, _, _ := strings.Cut(trimmed, "\n")
+		var probe struct {
+			Action  string          `json:"Action"`
+			Results json.RawMessage `json:"results"`
+		}
+		if json.Unmarshal([]byte(firstLine), &probe) == nil && probe.Action != "" {
+			return formatGoTest
+		}
+		if json.Unmarshal([]byte(trimmed), &probe) == nil && probe.Results != nil {
+			return formatCTRF
+		}
+	default:
+		firstLine, _, _ := strings.Cut(trimmed, "\n")
+		if strings.HasPrefix(firstLine, "TAP version") ||
+			strings.HasPrefix(firstLine, "1..") ||
+			strings.HasPrefix(firstLine, "ok ") ||
+			strings.HasPrefix(firstLine, "not ok ") {
+			return formatTAP
+		}
+	}
+	return ""
+}
+
+// rootElement returns the name of the root element of an XML document.
+func rootElement(content string) string {
+	dec := xml.NewDecoder(strings.NewReader(content))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// parseReport parses a report in any supported format. The name of the report
+// is used for formats that don't name their suites.
+func parseReport(name, content string) (*Results, error) {
+	switch detectFormat(content) {
+	case formatJUnit:
+		return parseJUnit(content)
+	case formatTAP:
+		return parseTAP(name, content), nil
+	case formatGoTest:
+		return parseGoTest(content)
+	case formatXUnit:
+		return parseXUnit(content)
+	case formatNUnit:
+		return parseNUnit(content)
+	case formatTRX:
+		return parseTRX(name, content)
+	case formatCTRF:
+		return parseCTRF(name, content)
+	default:
+		return nil, fmt.Errorf("%s: unsupported report format", name)
+	}
+}
+
+// reportName returns a suite name for a report file, i.e. its base name
+// without extension.
+func reportName(file string) string {
+	base := path.Base(file)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// parseJUnit parses a JUnit XML report.
+func parseJUnit(content string) (*Results, error) {
+	suites, err := junit.IngestReader(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	results := &Results{}
+	for _, suite := range suites {
+		results.add(suite)
+	}
+
+	// go-junit drops suite attributes when the suite has properties, as
+	// Surefire's always do, so read timestamps separately
+	timestamps, err := suiteTimestamps(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(timestamps) == len(results.Suites) {
+		for i, suite := range results.Suites {
+			suite.Timestamp = timestamps[i]
+		}
+	}
+
+	return results, nil
+}
+
+// suiteTimestamps returns the timestamp attribute of every testsuite element,
+// in document order.
+func suiteTimestamps(content string) ([]string, error) {
+	var timestamps []string
+	dec := xml.NewDecoder(strings.NewReader(content))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "testsuite" {
+			continue
+		}
+		var timestamp string
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "timestamp" {
+				timestamp = attr.Value
+			}
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+	return timestamps, nil
+}
+
+// parseTAP parses Test Anything Protocol output as a single suite.
+//
+// Only top-level test points are reported; indented subtests are ignored.
+// YAML diagnostics are attached to the preceding test, including its message
+// and a duration_ms field, as emitted by node:test.
+func parseTAP(name, content string) *Results {
+	suite := &Suite{Name: reportName(name)}
+
+	var test *TestCase
+	var yaml []string
+	inYAML := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if inYAML {
+			if strings.TrimSpace(line) == "..." {
+				inYAML = false
+				if test != nil {
+					test.Details = strings.Join(yaml, "\n")
+					if message := tapField(yaml, "message"); message != "" {
+						test.Message = strings.Trim(message, `"'`)
+					}
+					if ms, err := strconv.ParseFloat(tapField(yaml, "duration_ms"), 64); err == nil {
+						test.Duration = ms / 1000
+					}
+				}
+				yaml = nil
+				continue
+			}
+			yaml = append(yaml, strings.TrimPrefix(line, "  "))
+			continue
+		}
+
+		if strings.TrimSpace(line) == "---" && strings.HasPrefix(line, " ") {
+			inYAML = true
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			suite.SystemOut += strings.TrimSpace(strings.TrimPrefix(line, "#")) + "\n"
+			continue
+		}
+
+		status := "passed"
+		rest, ok := strings.CutPrefix(line, "ok")
+		if !ok {
+			rest, ok = strings.CutPrefix(line, "not ok")
+			status = "failed"
+		}
+		if !ok || (rest != "" && rest[0] != ' ') {
+			continue
+		}
+
+		// ok 1 - description # SKIP reason
+		desc, directive, _ := strings.Cut(rest, "#")
+		desc = strings.TrimSpace(desc)
+		if number, after, found := strings.Cut(desc, " "); found && isDigits(number) {
+			desc = strings.TrimSpace(after)
+		} else if isDigits(desc) {
+			desc = ""
+		}
+		desc = strings.TrimSpace(strings.TrimPrefix(desc, "- "))
+		if desc == "" || desc == "-" {
+			desc = fmt.Sprintf("test %d", len(suite.Tests)+1)
+		}
+
+		test = &TestCase{
+			Suite:  suite.Name,
+			Name:   desc,
+			Status: status,
+		}
+		directive = strings.TrimSpace(directive)
+		switch upper := strings.ToUpper(directive); {
+		case strings.HasPrefix(upper, "SKIP"), strings.HasPrefix(upper, "TODO"):
+			// failing TODO tests are expected to fail
+			test.Status = "skipped"
+			test.Message = strings.TrimSpace(directive[4:])
+		}
+		suite.Tests = append(suite.Tests, test)
+	}
+
+	suite.Totals = totals(suite.Tests)
+	return &Results{Suites: []*Suite{suite}}
+}
+
+// tapField returns the value of a top-level field in a YAML diagnostic block.
+func tapField(yaml []string, key string) string {
+	for _, line := range yaml {
+		if value, ok := strings.CutPrefix(line, key+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// goTestEvent is a single event emitted by go test -json.
+type goTestEvent struct {
+	Time    string
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+
+	// Set on build-output events since Go 1.24, e.g. "foo [foo.test]".
+	ImportPath string
+	// Set on a package's fail event when it failed to build, matching the
+	// ImportPath of its build-output events.
+	FailedBuild string
+}
+
+// parseGoTest parses a go test -json event stream, with a suite per package
+// and a test per test or subtest.
+func parseGoTest(content string) (*Results, error) {
+	results := &Results{}
+	suites := map[string]*Suite{}
+	tests := map[string]*TestCase{}
+	// compiler output by ImportPath, and the package-level fail events, for
+	// reporting packages that failed outside of any test
+	buildOutput := map[string]string{}
+	failed := map[string]*goTestEvent{}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var event goTestEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("decode test event: %w", err)
+		}
+		if event.Action == "build-output" {
+			buildOutput[event.ImportPath] += event.Output
+			continue
+		}
+		if event.Package == "" {
+			continue
+		}
+
+		suite, found := suites[event.Package]
+		if !found {
+			suite = &Suite{
+				Name:      event.Package,
+				Package:   event.Package,
+				Timestamp: event.Time,
+			}
+			suites[event.Package] = suite
+			results.Suites = append(results.Suites, suite)
+		}
+
+		if event.Test == "" {
+			switch event.Action {
+			case "output":
+				suite.SystemOut += event.Output
+			case "fail":
+				failed[event.Package] = &event
+			}
+			continue
+		}
+
+		key := event.Package + " " + event.Test
+		test, found := tests[key]
+		if !found {
+			test = &TestCase{
+				Suite:     suite.Name,
+				Name:      event.Test,
+				Classname: event.Package,
+			}
+			tests[key] = test
+			suite.Tests = append(suite.Tests, test)
+		}
+
+		switch event.Action {
+		case "output":
+			test.SystemOut += event.Output
+		case "pass":
+			test.Status = "passed"
+			test.Duration = event.Elapsed
+		case "fail":
+			test.Status = "failed"
+			test.Duration = event.Elapsed
+		case "skip":
+			test.Status = "skipped"
+			test.Duration = event.Elapsed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suite := range results.Suites {
+		testFailed := false
+		for _, test := range suite.Tests {
+			if test.Status == "" {
+				// the test never finished, e.g. it panicked or timed out
+				test.Status = "failed"
+			}
+			testFailed = testFailed || test.failed()
+		}
+		if event, found := failed[suite.Package]; found && !testFailed {
+			// the package failed outside of any test, e.g. it failed to build or
+			// TestMain panicked, so report it as a test of its own
+			suite.Tests = append(suite.Tests, &TestCase{
+				Suite:     suite.Name,
+				Name:      suite.Package,
+				Classname: suite.Package,
+				Status:    "error",
+				Duration:  event.Elapsed,
+				SystemOut: buildOutput[event.FailedBuild] + suite.SystemOut,
+			})
+		}
+		suite.Totals = totals(suite.Tests)
+	}
+
+	return results, nil
+}
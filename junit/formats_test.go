@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGoTestPackageFailure(t *testing.T) {
+	// a package that fails to build, as of Go 1.24, and one whose TestMain
+	// panics after its tests pass
+	results, err := parseGoTest(`{"ImportPath":"example.com/broken [example.com/broken.test]","Action":"build-output","Output":"# example.com/broken\n"}
+{"ImportPath":"example.com/broken [example.com/broken.test]","Action":"build-output","Output":"./broken.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/broken [example.com/broken.test]","Action":"build-fail"}
+{"Time":"2024-01-02T15:04:05Z","Action":"start","Package":"example.com/broken"}
+{"Time":"2024-01-02T15:04:05Z","Action":"output","Package":"example.com/broken","Output":"FAIL\texample.com/broken [build failed]\n"}
+{"Time":"2024-01-02T15:04:05Z","Action":"fail","Package":"example.com/broken","Elapsed":0,"FailedBuild":"example.com/broken [example.com/broken.test]"}
+{"Time":"2024-01-02T15:04:05Z","Action":"start","Package":"example.com/main"}
+{"Time":"2024-01-02T15:04:05Z","Action":"run","Package":"example.com/main","Test":"TestOK"}
+{"Time":"2024-01-02T15:04:05Z","Action":"pass","Package":"example.com/main","Test":"TestOK","Elapsed":0.01}
+{"Time":"2024-01-02T15:04:05Z","Action":"output","Package":"example.com/main","Output":"panic: teardown\n"}
+{"Time":"2024-01-02T15:04:06Z","Action":"fail","Package":"example.com/main","Elapsed":0.5}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := results.Failed()
+	if len(failed) != 2 {
+		t.Fatalf("got %d failed tests, want 2", len(failed))
+	}
+
+	broken := failed[0]
+	if broken.Name != "example.com/broken" || broken.Status != "error" {
+		t.Errorf("got %s %s, want example.com/broken error", broken.Name, broken.Status)
+	}
+	want := "# example.com/broken\n./broken.go:3:1: syntax error\nFAIL\texample.com/broken [build failed]\n"
+	if broken.SystemOut != want {
+		t.Errorf("got output %q, want %q", broken.SystemOut, want)
+	}
+
+	teardown := failed[1]
+	if teardown.Name != "example.com/main" || teardown.Duration != 0.5 {
+		t.Errorf("got %s in %gs, want example.com/main in 0.5s", teardown.Name, teardown.Duration)
+	}
+	if !strings.Contains(teardown.SystemOut, "panic: teardown") {
+		t.Errorf("output does not include the panic: %q", teardown.SystemOut)
+	}
+}
+
+func TestParseGoTestFailedTest(t *testing.T) {
+	results, err := parseGoTest(`{"Action":"run","Package":"example.com/pkg","Test":"TestBad"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestBad","Output":"bad_test.go:5: oops\n"}
+{"Action":"fail","Package":"example.com/pkg","Test":"TestBad","Elapsed":0.1}
+{"Action":"fail","Package":"example.com/pkg","Elapsed":0.2}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failing test explains the package failure, so it's reported alone
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0].Name != "TestBad" {
+		t.Fatalf("got %d failed tests, want only TestBad", len(failed))
+	}
+}
+
+func TestParseTAP(t *testing.T) {
+	results := parseTAP("reports/unit.tap", `TAP version 13
+1..4
+ok 1 - adds numbers
+not ok 2 - divides by zero
+  ---
+  message: "expected an error"
+  duration_ms: 250
+  ...
+ok 3 # SKIP no network
+not ok 4 - flaky thing # TODO fix later
+`)
+	suite := results.Suites[0]
+	if suite.Name != "unit" || len(suite.Tests) != 4 {
+		t.Fatalf("got suite %q with %d tests, want unit with 4", suite.Name, len(suite.Tests))
+	}
+	if test := suite.Tests[1]; test.Status != "failed" || test.Message != "expected an error" || test.Duration != 0.25 {
+		t.Errorf("got %s %q in %gs, want failed with the YAML diagnostics", test.Status, test.Message, test.Duration)
+	}
+	// unnamed tests are numbered, and failing TODO tests are expected to fail
+	if test := suite.Tests[2]; test.Name != "test 3" || test.Status != "skipped" || test.Message != "no network" {
+		t.Errorf("got %q %s %q, want a numbered skip", test.Name, test.Status, test.Message)
+	}
+	if test := suite.Tests[3]; test.Status != "skipped" {
+		t.Errorf("got %s, want a failing TODO skipped", test.Status)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"dagger/junit/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// History is the trend of each test over recent runs.
+type History struct {
+	// The runs considered, oldest first.
+	Runs []string
+
+	// The trend of each test, most often failing first.
+	Tests []*TestTrend
+}
+
+// TestTrend is the health of a single test over recent runs.
+type TestTrend struct {
+	// The name of the suite containing the test.
+	Suite string
+
+	// The class or module containing the test.
+	Classname string
+
+	// The name of the test.
+	Name string
+
+	// How many runs reported the test.
+	Runs int
+
+	// How many runs the test failed or errored in.
+	Failures int
+
+	// The fraction of runs the test failed in, excluding runs that skipped it.
+	FailureRate float64
+
+	// How often the test flipped between passing and failing from one run to
+	// the next, from 0 (never) to 1 (every run).
+	Flakiness float64
+
+	// The median duration, in seconds.
+	P50 float64
+
+	// The 95th percentile duration, in seconds.
+	P95 float64
+
+	// The status of the test in the latest run that reported it.
+	LastStatus string
+
+	// If the test is failing, the run in which it started failing.
+	FirstFailingRun string
+}
+
+// historyRun is a single line of a history file.
+type historyRun struct {
+	Run   string         `json:"run"`
+	Time  time.Time      `json:"time"`
+	Tests []*historyTest `json:"tests"`
+}
+
+type historyTest struct {
+	Suite     string  `json:"suite"`
+	Classname string  `json:"classname,omitempty"`
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Duration  float64 `json:"duration"`
+}
+
+// Record appends the results of a run to a history file, returning the
+// updated file.
+//
+// The history is a JSONL file with one line per run, so it can be kept as a
+// CI artifact or in a cache and passed back in for the next run.
+func (m *Junit) Record(
+	ctx context.Context,
+	// Test reports from the run, in any format supported by Parse.
+	reports *dagger.Directory,
+	// The history to append to.
+	// +optional
+	history *dagger.File,
+	// An identifier for the run, e.g. a commit SHA or CI build number.
+	// Defaults to the current time.
+	// +optional
+	run string,
+) (*dagger.File, error) {
+	var existing string
+	if history != nil {
+		var err error
+		existing, err = history.Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if existing != "" && !strings.HasSuffix(existing, "\n") {
+			existing += "\n"
+		}
+	}
+
+	results, err := m.ParseAll(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if run == "" {
+		run = now.Format(time.RFC3339)
+	}
+	entry := historyRun{
+		Run:  run,
+		Time: now,
+	}
+	for _, test := range results.dedupe().Tests() {
+		entry.Tests = append(entry.Tests, &historyTest{
+			Suite:     test.Suite,
+			Classname: test.Classname,
+			Name:      test.Name,
+			Status:    test.Status,
+			Duration:  test.Duration,
+		})
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Directory().
+		WithNewFile("history.jsonl", existing+string(line)+"\n").
+		File("history.jsonl"), nil
+}
+
+// History analyzes the trend of each test over the most recent runs in a
+// history file written by Record.
+func (m *Junit) History(
+	ctx context.Context,
+	// The history file.
+	history *dagger.File,
+	// How many of the most recent runs to consider.
+	// +optional
+	// +default=20
+	last int,
+) (*History, error) {
+	content, err := history.Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := parseHistory(content)
+	if err != nil {
+		return nil, err
+	}
+	if last > 0 && len(runs) > last {
+		runs = runs[len(runs)-last:]
+	}
+	return analyzeHistory(runs), nil
+}
+
+// Flaky returns the tests that flipped between passing and failing at least
+// once, flakiest first.
+func (h *History) Flaky() []*TestTrend {
+	var flaky []*TestTrend
+	for _, trend := range h.Tests {
+		if trend.Flakiness > 0 {
+			flaky = append(flaky, trend)
+		}
+	}
+	sort.SliceStable(flaky, func(i, j int) bool {
+		return flaky[i].Flakiness > flaky[j].Flakiness
+	})
+	return flaky
+}
+
+// parseHistory decodes a history file, oldest run first.
+func parseHistory(content string) ([]*historyRun, error) {
+	var runs []*historyRun
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var run historyRun
+		if err := json.Unmarshal([]byte(line), &run); err != nil {
+			return nil, fmt.Errorf("decode history: %w", err)
+		}
+		runs = append(runs, &run)
+	}
+	return runs, scanner.Err()
+}
+
+// analyzeHistory computes the trend of each test across the runs.
+func analyzeHistory(runs []*historyRun) *History {
+	h := &History{}
+	trends := map[string]*TestTrend{}
+	durations := map[string][]float64{}
+	// the pass/fail outcome of each test in the previous run that reported
+	// it, for counting flips
+	lastFailed := map[string]bool{}
+	flips := map[string]int{}
+	outcomes := map[string]int{}
+
+	for _, run := range runs {
+		h.Runs = append(h.Runs, run.Run)
+		for _, test := range run.Tests {
+			key := test.Suite + "\x00" + test.Classname + "\x00" + test.Name
+			trend, found := trends[key]
+			if !found {
+				trend = &TestTrend{
+					Suite:     test.Suite,
+					Classname: test.Classname,
+					Name:      test.Name,
+				}
+				trends[key] = trend
+				h.Tests = append(h.Tests, trend)
+			}
+
+			trend.Runs++
+			trend.LastStatus = test.Status
+			if test.Status == "skipped" {
+				continue
+			}
+			durations[key] = append(durations[key], test.Duration)
+
+			failed := test.Status == "failed" || test.Status == "error"
+			if failed {
+				trend.Failures++
+				if trend.FirstFailingRun == "" {
+					trend.FirstFailingRun = run.Run
+				}
+			} else {
+				trend.FirstFailingRun = ""
+			}
+
+			if prev, found := lastFailed[key]; found && prev != failed {
+				flips[key]++
+			}
+			lastFailed[key] = failed
+			outcomes[key]++
+		}
+	}
+
+	for key, trend := range trends {
+		if outcomes[key] > 0 {
+			trend.FailureRate = float64(trend.Failures) / float64(outcomes[key])
+		}
+		if outcomes[key] > 1 {
+			trend.Flakiness = float64(flips[key]) / float64(outcomes[key]-1)
+		}
+		sort.Float64s(durations[key])
+		trend.P50 = percentile(durations[key], 50)
+		trend.P95 = percentile(durations[key], 95)
+	}
+
+	sort.SliceStable(h.Tests, func(i, j int) bool {
+		if h.Tests[i].FailureRate != h.Tests[j].FailureRate {
+			return h.Tests[i].FailureRate > h.Tests[j].FailureRate
+		}
+		return h.Tests[i].Flakiness > h.Tests[j].Flakiness
+	})
+
+	return h
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
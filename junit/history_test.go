@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestAnalyzeHistory(t *testing.T) {
+	runs := []*historyRun{
+		{Run: "1", Tests: []*historyTest{
+			{Name: "a", Status: "passed", Duration: 1},
+			{Name: "b", Status: "passed"},
+		}},
+		{Run: "2", Tests: []*historyTest{
+			{Name: "a", Status: "failed", Duration: 3},
+			{Name: "b", Status: "passed"},
+		}},
+		{Run: "3", Tests: []*historyTest{
+			{Name: "a", Status: "error", Duration: 2},
+			{Name: "b", Status: "skipped"},
+		}},
+	}
+
+	h := analyzeHistory(runs)
+	if len(h.Tests) != 2 || h.Tests[0].Name != "a" {
+		t.Fatalf("got %d tests, want a first", len(h.Tests))
+	}
+
+	// a started failing in run 2 and kept failing
+	a := h.Tests[0]
+	if a.FailureRate != 2.0/3 || a.Flakiness != 0.5 || a.FirstFailingRun != "2" {
+		t.Errorf("a: got failure rate %g, flakiness %g, first failing run %q",
+			a.FailureRate, a.Flakiness, a.FirstFailingRun)
+	}
+	if a.P50 != 2 || a.P95 != 3 {
+		t.Errorf("a: got p50 %g and p95 %g, want 2 and 3", a.P50, a.P95)
+	}
+
+	// skipped runs count as runs, but not towards the rates
+	if b := h.Tests[1]; b.Runs != 3 || b.FailureRate != 0 || b.Flakiness != 0 || b.LastStatus != "skipped" {
+		t.Errorf("b: got %+v", *b)
+	}
+}
@@ -25,46 +25,55 @@ import (
 	"strings"
 	"time"
 
-	"github.com/joshdk/go-junit"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
-	"golang.org/x/sync/errgroup"
 )
 
 type Junit struct{}
 
-// Report converts a JUnit XML report to OpenTelemetry spans.
-func (m *Junit) ReportAll(ctx context.Context, reports *dagger.Directory) error {
-	paths, err := reports.Glob(ctx, "**/*.xml")
+// ReportAll converts every test report in a directory to OpenTelemetry spans,
+// detecting the format of each file.
+func (m *Junit) ReportAll(
+	ctx context.Context,
+	reports *dagger.Directory,
+	// Return an error if any test failed or errored.
+	// +optional
+	failOnError bool,
+	// Tests whose failures don't fail the call, by name, classname.name, or
+	// regular expression matching either.
+	// +optional
+	quarantine []string,
+) error {
+	results, err := m.ParseAll(ctx, reports)
 	if err != nil {
 		return err
 	}
-
-	eg := new(errgroup.Group)
-	for _, path := range paths {
-		report := reports.File(path)
-		eg.Go(func() error {
-			return m.Report(ctx, report)
-		})
-	}
-
-	return eg.Wait()
+	return m.report(ctx, results, failOnError, newQuarantine(quarantine))
 }
 
-// Report converts a JUnit XML report to OpenTelemetry spans.
-func (m *Junit) Report(ctx context.Context, report *dagger.File) error {
-	reportXML, err := report.Contents(ctx)
-	if err != nil {
-		return err
-	}
-
-	// Parse the JUnit XML
-	suites, err := junit.IngestReader(strings.NewReader(reportXML))
+// Report converts a test report to OpenTelemetry spans. See Parse for the
+// supported formats.
+func (m *Junit) Report(
+	ctx context.Context,
+	report *dagger.File,
+	// Return an error if any test failed or errored.
+	// +optional
+	failOnError bool,
+	// Tests whose failures don't fail the call, by name, classname.name, or
+	// regular expression matching either.
+	// +optional
+	quarantine []string,
+) error {
+	results, err := m.Parse(ctx, report)
 	if err != nil {
 		return err
 	}
+	return m.report(ctx, results, failOnError, newQuarantine(quarantine))
+}
 
+// report emits a span for each suite, with a child span for each test.
+func (m *Junit) report(ctx context.Context, results *Results, failOnError bool, q *quarantine) error {
 	fmt.Println("\nParsed JUnit Report Details:")
 	fmt.Println("============================")
 
@@ -73,19 +82,17 @@ func (m *Junit) Report(ctx context.Context, report *dagger.File) error {
 
 	now := time.Now()
 
-	for _, suite := range suites {
+	for _, suite := range results.Suites {
 		enc.Encode(suite)
 
-		// unfortunately JUnit doesn't record suite/test start time, so we'll work
-		// backwards from the longest test duration and pretend that's when we
-		// started
-		suiteStartTime := now
-		for _, test := range suite.Tests {
-			testStartTime := now.Add(-test.Duration)
-			if testStartTime.Before(suiteStartTime) {
-				testStartTime = suiteStartTime
-			}
+		// tests within a suite run sequentially, so lay them out back-to-back
+		// from when the suite started; if the report doesn't say, pretend the
+		// suite just finished
+		suiteStartTime, ok := parseTimestamp(suite.Timestamp)
+		if !ok {
+			suiteStartTime = now.Add(-seconds(suite.Totals.Duration))
 		}
+		suiteEndTime := suiteStartTime.Add(seconds(suite.Totals.Duration))
 
 		suiteCtx, suiteSpan := Tracer().Start(ctx, suite.Name,
 			trace.WithTimestamp(suiteStartTime),
@@ -95,8 +102,9 @@ func (m *Junit) Report(ctx context.Context, report *dagger.File) error {
 			telemetry.Reveal(),
 		)
 
+		testStartTime := suiteStartTime
 		for _, test := range suite.Tests {
-			testStartTime := now.Add(-test.Duration)
+			testEndTime := testStartTime.Add(seconds(test.Duration))
 
 			testCtx, testSpan := Tracer().Start(suiteCtx, test.Name, trace.WithTimestamp(testStartTime))
 
@@ -113,27 +121,36 @@ func (m *Junit) Report(ctx context.Context, report *dagger.File) error {
 				fmt.Fprint(stdio.Stderr, test.SystemErr)
 			}
 
+			if test.failed() && q.matches(test) {
+				testSpan.SetAttributes(attribute.Bool("junit.test.quarantined", true))
+				fmt.Fprintln(stdio.Stderr, "QUARANTINED")
+			}
+
 			switch test.Status {
 			case "passed":
 			case "failed":
 				fmt.Fprintln(stdio.Stderr, "FAILED")
 				testSpan.SetStatus(codes.Error, test.Message)
+			case "error":
+				fmt.Fprintln(stdio.Stderr, "ERROR")
+				testSpan.SetStatus(codes.Error, test.Message)
 			case "skipped":
 				testSpan.SetAttributes(attribute.Bool(telemetry.CanceledAttr, true))
 				fmt.Fprintln(stdio.Stdout, "SKIPPED")
 				testSpan.SetStatus(codes.Error, test.Message)
 			}
 
-			if test.Error != nil {
-				fmt.Fprintln(stdio.Stderr, "ERROR:", test.Error.Error())
+			if test.Details != "" {
+				fmt.Fprintln(stdio.Stderr, test.Details)
 			}
 
-			testSpan.End()
+			testSpan.End(trace.WithTimestamp(testEndTime))
+			testStartTime = testEndTime
 		}
 
 		var errs error
-		if suite.Totals.Error > 0 {
-			errs = errors.Join(errs, fmt.Errorf("%d errors", suite.Totals.Error))
+		if suite.Totals.Errored > 0 {
+			errs = errors.Join(errs, fmt.Errorf("%d errors", suite.Totals.Errored))
 		}
 		if suite.Totals.Failed > 0 {
 			errs = errors.Join(errs, fmt.Errorf("%d failed", suite.Totals.Failed))
@@ -142,23 +159,83 @@ func (m *Junit) Report(ctx context.Context, report *dagger.File) error {
 			suiteSpan.SetStatus(codes.Error, errs.Error())
 		}
 
-		suiteSpan.End()
+		suiteSpan.End(trace.WithTimestamp(suiteEndTime))
 	}
 
 	time.Sleep(time.Second)
 
+	if failOnError {
+		return checkFailures(results, q)
+	}
 	return nil
 }
 
+// checkFailures returns an error summarizing the failed tests that aren't
+// quarantined.
+func checkFailures(results *Results, q *quarantine) error {
+	var failed []*TestCase
+	var quarantined int
+	for _, test := range results.Failed() {
+		if q.matches(test) {
+			quarantined++
+		} else {
+			failed = append(failed, test)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	msg := new(strings.Builder)
+	fmt.Fprintf(msg, "%d tests failed", len(failed))
+	if quarantined > 0 {
+		fmt.Fprintf(msg, " (%d quarantined failures ignored)", quarantined)
+	}
+	msg.WriteString(":")
+	for _, test := range failed {
+		fmt.Fprintf(msg, "\n  %s", test.describe())
+		if line, _, _ := strings.Cut(strings.TrimSpace(test.Message), "\n"); line != "" {
+			fmt.Fprintf(msg, ": %s", line)
+		}
+	}
+	return errors.New(msg.String())
+}
+
+// timestampLayouts are the formats reporters use for suite timestamps, which
+// often lack a time zone.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+}
+
+// parseTimestamp parses a suite timestamp, assuming UTC if no time zone is
+// given.
+func parseTimestamp(timestamp string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// seconds converts a duration in seconds to a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
 // ExampleReports runs the Java tests in the example directory and returns the JUnit XML reports.
 func (m *Junit) ExampleReports(
+	ctx context.Context,
 	// +defaultPath=./example/
 	dir *dagger.Directory,
-) *dagger.Directory {
-	return dag.Container().
-		From("maven:3.9-eclipse-temurin-11").
-		WithMountedDirectory("/app", dir).
-		WithWorkdir("/app").
-		WithExec([]string{"mvn", "clean", "test"}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
-		Directory("/app/target/surefire-reports")
+) (*dagger.Directory, error) {
+	tests, err := m.Maven(ctx, dir, dag.Container().From("maven:3.9-eclipse-temurin-11"), nil)
+	if err != nil {
+		return nil, err
+	}
+	// keep the reports flat, as they were before the Maven runner
+	return tests.Reports.Directory("target/surefire-reports"), nil
 }
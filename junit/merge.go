@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"dagger/junit/internal/dagger"
+	"encoding/xml"
+	"fmt"
+)
+
+// Merge combines a directory of JUnit XML reports into a single report.
+//
+// Tests reported more than once, e.g. because they were retried, are
+// de-duplicated by suite, class, and name; the last result wins, reading
+// reports in path order.
+func (m *Junit) Merge(ctx context.Context, reports *dagger.Directory) (*dagger.File, error) {
+	results, err := m.ParseAll(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := results.dedupe().xml()
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Directory().
+		WithNewFile("junit.xml", out).
+		File("junit.xml"), nil
+}
+
+// dedupe returns the results with each test reported once, keeping its last
+// result, and suites of the same name combined.
+func (r *Results) dedupe() *Results {
+	deduped := &Results{}
+	suites := map[string]*Suite{}
+	tests := map[string]int{}
+	for _, suite := range r.Suites {
+		merged, found := suites[suite.Name]
+		if !found {
+			merged = &Suite{
+				Name:      suite.Name,
+				Package:   suite.Package,
+				Timestamp: suite.Timestamp,
+			}
+			suites[suite.Name] = merged
+			deduped.Suites = append(deduped.Suites, merged)
+		}
+		merged.SystemOut += suite.SystemOut
+		merged.SystemErr += suite.SystemErr
+
+		for _, test := range suite.Tests {
+			key := test.key()
+			if i, found := tests[key]; found {
+				merged.Tests[i] = test
+				continue
+			}
+			tests[key] = len(merged.Tests)
+			merged.Tests = append(merged.Tests, test)
+		}
+	}
+	for _, suite := range deduped.Suites {
+		suite.Totals = totals(suite.Tests)
+	}
+	return deduped
+}
+
+// key identifies a test across reports.
+func (t *TestCase) key() string {
+	return t.Suite + "\x00" + t.Classname + "\x00" + t.Name
+}
+
+type xmlTestsuites struct {
+	XMLName  xml.Name       `xml:"testsuites"`
+	Tests    int            `xml:"tests,attr"`
+	Failures int            `xml:"failures,attr"`
+	Errors   int            `xml:"errors,attr"`
+	Skipped  int            `xml:"skipped,attr"`
+	Time     string         `xml:"time,attr"`
+	Suites   []xmlTestsuite `xml:"testsuite"`
+}
+
+type xmlTestsuite struct {
+	Name      string        `xml:"name,attr"`
+	Package   string        `xml:"package,attr,omitempty"`
+	Timestamp string        `xml:"timestamp,attr,omitempty"`
+	Tests     int           `xml:"tests,attr"`
+	Failures  int           `xml:"failures,attr"`
+	Errors    int           `xml:"errors,attr"`
+	Skipped   int           `xml:"skipped,attr"`
+	Time      string        `xml:"time,attr"`
+	Cases     []xmlTestcase `xml:"testcase"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type xmlTestcase struct {
+	Name      string     `xml:"name,attr"`
+	Classname string     `xml:"classname,attr,omitempty"`
+	Time      string     `xml:"time,attr"`
+	Failure   *xmlResult `xml:"failure"`
+	Error     *xmlResult `xml:"error"`
+	Skipped   *xmlResult `xml:"skipped"`
+	SystemOut string     `xml:"system-out,omitempty"`
+	SystemErr string     `xml:"system-err,omitempty"`
+}
+
+type xmlResult struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// xml encodes the results as a JUnit XML report.
+func (r *Results) xml() (string, error) {
+	total := r.Totals()
+	doc := xmlTestsuites{
+		Tests:    total.Tests,
+		Failures: total.Failed,
+		Errors:   total.Errored,
+		Skipped:  total.Skipped,
+		Time:     formatSeconds(total.Duration),
+	}
+	for _, suite := range r.Suites {
+		xs := xmlTestsuite{
+			Name:      suite.Name,
+			Package:   suite.Package,
+			Timestamp: suite.Timestamp,
+			Tests:     suite.Totals.Tests,
+			Failures:  suite.Totals.Failed,
+			Errors:    suite.Totals.Errored,
+			Skipped:   suite.Totals.Skipped,
+			Time:      formatSeconds(suite.Totals.Duration),
+			SystemOut: suite.SystemOut,
+			SystemErr: suite.SystemErr,
+		}
+		for _, test := range suite.Tests {
+			xc := xmlTestcase{
+				Name:      test.Name,
+				Classname: test.Classname,
+				Time:      formatSeconds(test.Duration),
+				SystemOut: test.SystemOut,
+				SystemErr: test.SystemErr,
+			}
+			result := &xmlResult{Message: test.Message, Body: test.Details}
+			switch test.Status {
+			case "failed":
+				xc.Failure = result
+			case "error":
+				xc.Error = result
+			case "skipped":
+				xc.Skipped = result
+			}
+			xs.Cases = append(xs.Cases, xc)
+		}
+		doc.Suites = append(doc.Suites, xs)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(out) + "\n", nil
+}
+
+func formatSeconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestDedupe(t *testing.T) {
+	// the same suite reported by two runs, with a failed test re-run
+	deduped := (&Results{
+		Suites: []*Suite{
+			{Name: "api", SystemOut: "first\n", Tests: []*TestCase{
+				{Suite: "api", Name: "creates", Status: "passed"},
+				{Suite: "api", Name: "deletes", Status: "failed"},
+			}},
+			{Name: "api", SystemOut: "second\n", Tests: []*TestCase{
+				{Suite: "api", Name: "deletes", Status: "passed"},
+			}},
+		},
+	}).dedupe()
+
+	if len(deduped.Suites) != 1 {
+		t.Fatalf("got %d suites, want 1", len(deduped.Suites))
+	}
+	suite := deduped.Suites[0]
+	if suite.SystemOut != "first\nsecond\n" {
+		t.Errorf("got output %q, want both runs' output", suite.SystemOut)
+	}
+	if len(suite.Tests) != 2 || suite.Tests[1].Name != "deletes" || suite.Tests[1].Status != "passed" {
+		t.Errorf("got tests %v, want deletes kept in place with its last result", suite.Tests)
+	}
+	if suite.Totals.Failed != 0 {
+		t.Errorf("got %d failed, want 0", suite.Totals.Failed)
+	}
+}
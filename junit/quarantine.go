@@ -0,0 +1,42 @@
+package main
+
+import "regexp"
+
+// quarantine is a set of tests whose failures are tolerated.
+type quarantine struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// newQuarantine compiles quarantine entries, each a test name, a
+// classname.name, or a regular expression matching either. Entries that
+// aren't valid regular expressions, e.g. names with brackets, match exactly.
+func newQuarantine(entries []string) *quarantine {
+	q := &quarantine{names: map[string]bool{}}
+	for _, entry := range entries {
+		q.names[entry] = true
+		if re, err := regexp.Compile("^(?:" + entry + ")$"); err == nil {
+			q.patterns = append(q.patterns, re)
+		}
+	}
+	return q
+}
+
+// matches reports whether the test is quarantined.
+func (q *quarantine) matches(test *TestCase) bool {
+	candidates := []string{test.Name}
+	if test.Classname != "" {
+		candidates = append(candidates, test.Classname+"."+test.Name)
+	}
+	for _, name := range candidates {
+		if q.names[name] {
+			return true
+		}
+		for _, re := range q.patterns {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"dagger/junit/internal/dagger"
+	"sort"
+	"strings"
+
+	"github.com/joshdk/go-junit"
+	"golang.org/x/sync/errgroup"
+)
+
+// Results is a parsed set of test reports.
+type Results struct {
+	// The test suites, with nested suites flattened.
+	Suites []*Suite
+}
+
+// Suite is a single test suite.
+type Suite struct {
+	// The name of the suite.
+	Name string
+
+	// The package of the suite, if reported.
+	Package string
+
+	// When the suite started, as reported, e.g. 2024-01-02T15:04:05.
+	Timestamp string
+
+	// The tests in the suite.
+	Tests []*TestCase
+
+	// Output printed by the suite outside of any test.
+	SystemOut string
+
+	// Error output printed by the suite outside of any test.
+	SystemErr string
+
+	// Aggregate counts for the suite.
+	Totals *Totals
+}
+
+// TestCase is the outcome of a single test.
+type TestCase struct {
+	// The name of the suite containing the test.
+	Suite string
+
+	// The name of the test.
+	Name string
+
+	// The class or module containing the test.
+	Classname string
+
+	// The status of the test: passed, failed, error, or skipped.
+	Status string
+
+	// How long the test took, in seconds.
+	Duration float64
+
+	// The failure, error, or skip message.
+	Message string
+
+	// Details of the failure or error, e.g. a stack trace.
+	Details string
+
+	// Output printed by the test.
+	SystemOut string
+
+	// Error output printed by the test.
+	SystemErr string
+}
+
+// Totals are aggregate counts of test outcomes.
+type Totals struct {
+	Tests   int
+	Passed  int
+	Failed  int
+	Errored int
+	Skipped int
+
+	// The sum of all test durations, in seconds.
+	Duration float64
+}
+
+// Parse parses a test report, detecting its format: JUnit XML, TAP,
+// go test -json, xUnit.net XML, NUnit XML, TRX, or CTRF JSON.
+func (m *Junit) Parse(ctx context.Context, report *dagger.File) (*Results, error) {
+	name, err := report.Name(ctx)
+	if err != nil {
+		return nil, err
+	}
+	content, err := report.Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseReport(name, content)
+}
+
+// ParseAll parses every test report in a directory, detecting the format of
+// each file. Files in unsupported formats are ignored.
+func (m *Junit) ParseAll(ctx context.Context, reports *dagger.Directory) (*Results, error) {
+	paths, err := reports.Glob(ctx, "**/*")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := make([]*Results, len(paths))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, path := range paths {
+		if strings.HasSuffix(path, "/") {
+			// a directory
+			continue
+		}
+		report := reports.File(path)
+		eg.Go(func() error {
+			content, err := report.Contents(ctx)
+			if err != nil {
+				return err
+			}
+			if detectFormat(content) == "" {
+				return nil
+			}
+			results, err := parseReport(path, content)
+			if err != nil {
+				return err
+			}
+			parsed[i] = results
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	results := &Results{}
+	for _, r := range parsed {
+		if r != nil {
+			results.Suites = append(results.Suites, r.Suites...)
+		}
+	}
+	return results, nil
+}
+
+// add converts a suite and appends it, followed by any nested suites.
+func (r *Results) add(suite junit.Suite) {
+	s := &Suite{
+		Name:      suite.Name,
+		Package:   suite.Package,
+		SystemOut: suite.SystemOut,
+		SystemErr: suite.SystemErr,
+	}
+	for _, test := range suite.Tests {
+		tc := &TestCase{
+			Suite:     suite.Name,
+			Name:      test.Name,
+			Classname: test.Classname,
+			Status:    string(test.Status),
+			Duration:  test.Duration.Seconds(),
+			Message:   test.Message,
+			SystemOut: test.SystemOut,
+			SystemErr: test.SystemErr,
+		}
+		if test.Error != nil {
+			tc.Details = test.Error.Error()
+		}
+		s.Tests = append(s.Tests, tc)
+	}
+	s.Totals = totals(s.Tests)
+	r.Suites = append(r.Suites, s)
+
+	for _, nested := range suite.Suites {
+		r.add(nested)
+	}
+}
+
+// Tests returns every test in every suite.
+func (r *Results) Tests() []*TestCase {
+	var tests []*TestCase
+	for _, suite := range r.Suites {
+		tests = append(tests, suite.Tests...)
+	}
+	return tests
+}
+
+// Totals returns aggregate counts across all suites.
+func (r *Results) Totals() *Totals {
+	return totals(r.Tests())
+}
+
+// Failed returns all tests that failed or errored.
+func (r *Results) Failed() []*TestCase {
+	var failed []*TestCase
+	for _, test := range r.Tests() {
+		if test.failed() {
+			failed = append(failed, test)
+		}
+	}
+	return failed
+}
+
+// Slowest returns the n slowest tests, slowest first.
+func (r *Results) Slowest(
+	// +optional
+	// +default=10
+	n int,
+) []*TestCase {
+	n = max(n, 0)
+	tests := r.Tests()
+	sort.SliceStable(tests, func(i, j int) bool {
+		return tests[i].Duration > tests[j].Duration
+	})
+	if n < len(tests) {
+		tests = tests[:n]
+	}
+	return tests
+}
+
+func totals(tests []*TestCase) *Totals {
+	t := &Totals{Tests: len(tests)}
+	for _, test := range tests {
+		t.Duration += test.Duration
+		switch test.Status {
+		case "passed":
+			t.Passed++
+		case "failed":
+			t.Failed++
+		case "error":
+			t.Errored++
+		case "skipped":
+			t.Skipped++
+		}
+	}
+	return t
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"dagger/junit/internal/dagger"
+)
+
+// TestRun is the outcome of running a test suite.
+type TestRun struct {
+	// The container that ran the tests.
+	Container *dagger.Container
+
+	// The test reports written by the run.
+	Reports *dagger.Directory
+
+	// The exit code of the test command.
+	ExitCode int
+}
+
+// Maven runs mvn with the Surefire and Failsafe plugins and collects their
+// JUnit XML reports, including from submodules.
+func (m *Junit) Maven(
+	ctx context.Context,
+	// The Maven project.
+	src *dagger.Directory,
+	// A container with Maven installed.
+	// +optional
+	base *dagger.Container,
+	// Arguments to pass to mvn.
+	// +optional
+	args []string,
+) (*TestRun, error) {
+	if base == nil {
+		base = dag.Container().From("maven:3.9-eclipse-temurin-21")
+	}
+	if len(args) == 0 {
+		args = []string{"clean", "test"}
+	}
+	ctr := base.
+		WithMountedCache("/root/.m2/repository", dag.CacheVolume("junit-maven")).
+		WithMountedDirectory("/src", src).
+		WithWorkdir("/src")
+	return run(ctx, ctr, append([]string{"mvn", "--batch-mode"}, args...), "/src",
+		// skip the *.txt summaries and failsafe-summary.xml
+		"**/target/surefire-reports/TEST-*.xml",
+		"**/target/failsafe-reports/TEST-*.xml")
+}
+
+// Gradle runs a Gradle build, using the project's wrapper if it has one, and
+// collects the JUnit XML reports of every test task.
+func (m *Junit) Gradle(
+	ctx context.Context,
+	// The Gradle project.
+	src *dagger.Directory,
+	// A container with a JDK and, if the project has no wrapper, Gradle
+	// installed.
+	// +optional
+	base *dagger.Container,
+	// Arguments to pass to gradle.
+	// +optional
+	args []string,
+) (*TestRun, error) {
+	if base == nil {
+		base = dag.Container().From("gradle:8-jdk21")
+	}
+	if len(args) == 0 {
+		// keep going after failures so every test task reports
+		args = []string{"test", "--continue"}
+	}
+	wrapper, err := src.Glob(ctx, "gradlew")
+	if err != nil {
+		return nil, err
+	}
+	gradle := "gradle"
+	if len(wrapper) > 0 {
+		gradle = "./gradlew"
+	}
+	ctr := base.
+		WithMountedCache("/root/.gradle", dag.CacheVolume("junit-gradle")).
+		WithEnvVariable("GRADLE_USER_HOME", "/root/.gradle").
+		WithMountedDirectory("/src", src).
+		WithWorkdir("/src")
+	return run(ctx, ctr, append([]string{gradle, "--no-daemon"}, args...), "/src",
+		"**/build/test-results/**/*.xml")
+}
+
+// Pytest installs the project's requirements and pytest, runs pytest, and
+// collects its JUnit XML report.
+func (m *Junit) Pytest(
+	ctx context.Context,
+	// The Python project.
+	src *dagger.Directory,
+	// A container with Python installed.
+	// +optional
+	base *dagger.Container,
+	// Arguments to pass to pytest.
+	// +optional
+	args []string,
+) (*TestRun, error) {
+	if base == nil {
+		base = dag.Container().From("python:3.12-slim")
+	}
+	ctr := base.
+		WithMountedCache("/root/.cache/pip", dag.CacheVolume("junit-pip")).
+		WithMountedDirectory("/src", src).
+		WithWorkdir("/src").
+		WithExec([]string{"sh", "-c",
+			"if [ -f requirements.txt ]; then pip install -r requirements.txt; fi && pip install pytest"})
+	pytest := append([]string{"python", "-m", "pytest", "--junitxml=/reports/pytest.xml"}, args...)
+	return run(ctx, ctr, pytest, "/reports", "*.xml")
+}
+
+// Jest installs the project's dependencies and jest-junit, runs Jest, and
+// collects its JUnit XML report.
+func (m *Junit) Jest(
+	ctx context.Context,
+	// The Node.js project.
+	src *dagger.Directory,
+	// A container with Node.js installed.
+	// +optional
+	base *dagger.Container,
+	// Arguments to pass to jest.
+	// +optional
+	args []string,
+) (*TestRun, error) {
+	if base == nil {
+		base = dag.Container().From("node:22-slim")
+	}
+	ctr := base.
+		WithMountedCache("/root/.npm", dag.CacheVolume("junit-npm")).
+		WithMountedDirectory("/src", src).
+		WithWorkdir("/src").
+		WithExec([]string{"sh", "-c",
+			"if [ -f package-lock.json ]; then npm ci; else npm install; fi && npm install --no-save jest-junit"}).
+		WithEnvVariable("JEST_JUNIT_OUTPUT_DIR", "/reports")
+	jest := append([]string{"npx", "jest", "--ci", "--reporters=default", "--reporters=jest-junit"}, args...)
+	return run(ctx, ctr, jest, "/reports", "*.xml")
+}
+
+// run runs a test command, tolerating failure, and collects the reports
+// matching the patterns under dir.
+func run(ctx context.Context, ctr *dagger.Container, cmd []string, dir string, patterns ...string) (*TestRun, error) {
+	ctr = ctr.
+		WithDirectory("/reports", dag.Directory()).
+		WithExec(cmd, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+
+	exitCode, err := ctr.ExitCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TestRun{
+		Container: ctr,
+		Reports: dag.Directory().WithDirectory("/", ctr.Directory(dir), dagger.DirectoryWithDirectoryOpts{
+			Include: patterns,
+		}),
+		ExitCode: exitCode,
+	}, nil
+}
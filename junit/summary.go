@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"dagger/junit/internal/dagger"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// summaryData is the input to the summary templates.
+type summaryData struct {
+	Totals   *Totals
+	Failures []*failureSummary
+	Slowest  []*TestCase
+}
+
+// failureSummary is a failed test with its output truncated.
+type failureSummary struct {
+	Test   *TestCase
+	Stdout string
+	Stderr string
+}
+
+var summaryFuncs = map[string]any{
+	"seconds": func(s float64) string {
+		return fmt.Sprintf("%.2fs", s)
+	},
+	"oneline": func(s string) string {
+		line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+		return line
+	},
+	// cell escapes a Markdown table cell
+	"cell": func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+	},
+	// fence wraps text in a Markdown code block, using a fence longer than any
+	// run of backticks in the text
+	"fence": func(s string) string {
+		fence := "```"
+		for strings.Contains(s, fence) {
+			fence += "`"
+		}
+		return fence + "\n" + strings.TrimRight(s, "\n") + "\n" + fence
+	},
+}
+
+// Markdown renders a summary of the test reports in a directory as Markdown,
+// e.g. for a pull request comment or CI step summary.
+func (m *Junit) Markdown(
+	ctx context.Context,
+	// Test reports, in any format supported by Parse.
+	reports *dagger.Directory,
+	// How many of the slowest tests to list.
+	// +optional
+	// +default=10
+	slowest int,
+	// How many characters of each failed test's output to include.
+	// +optional
+	// +default=2000
+	maxOutput int,
+) (string, error) {
+	tmpl, err := template.New("summary.md.tmpl").
+		Funcs(summaryFuncs).
+		ParseFS(templates, "templates/summary.md.tmpl")
+	if err != nil {
+		return "", err
+	}
+	out := new(strings.Builder)
+	if err := m.summarize(ctx, out, tmpl, reports, slowest, maxOutput); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Html renders a summary of the test reports in a directory as a single
+// self-contained HTML file.
+func (m *Junit) Html(
+	ctx context.Context,
+	// Test reports, in any format supported by Parse.
+	reports *dagger.Directory,
+	// How many of the slowest tests to list.
+	// +optional
+	// +default=10
+	slowest int,
+	// How many characters of each failed test's output to include.
+	// +optional
+	// +default=2000
+	maxOutput int,
+) (*dagger.File, error) {
+	tmpl, err := htmltemplate.New("summary.html.tmpl").
+		Funcs(summaryFuncs).
+		ParseFS(templates, "templates/summary.html.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	out := new(strings.Builder)
+	if err := m.summarize(ctx, out, tmpl, reports, slowest, maxOutput); err != nil {
+		return nil, err
+	}
+	return dag.Directory().
+		WithNewFile("report.html", out.String()).
+		File("report.html"), nil
+}
+
+// summarize parses the reports and renders them with the given template.
+func (m *Junit) summarize(
+	ctx context.Context,
+	w io.Writer,
+	tmpl interface {
+		Execute(io.Writer, any) error
+	},
+	reports *dagger.Directory,
+	slowest int,
+	maxOutput int,
+) error {
+	results, err := m.ParseAll(ctx, reports)
+	if err != nil {
+		return err
+	}
+	results = results.dedupe()
+
+	data := summaryData{
+		Totals:  results.Totals(),
+		Slowest: results.Slowest(slowest),
+	}
+	for _, test := range results.Failed() {
+		data.Failures = append(data.Failures, &failureSummary{
+			Test:   test,
+			Stdout: truncate(test.SystemOut, maxOutput),
+			Stderr: truncate(test.SystemErr, maxOutput),
+		})
+	}
+	return tmpl.Execute(w, data)
+}
+
+// truncate keeps the last n characters of the output, where failures are
+// usually reported.
+func truncate(output string, n int) string {
+	n = max(n, 0)
+	if len(output) <= n {
+		return output
+	}
+	output = strings.ToValidUTF8(output[len(output)-n:], "")
+	// don't start mid-line
+	if i := strings.IndexByte(output, '\n'); i != -1 && i < len(output)-1 {
+		output = output[i+1:]
+	}
+	return "[truncated]\n" + output
+}
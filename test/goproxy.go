@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dagger/test/internal/dagger"
+)
+
+// GoProxy builds a module against a private module served from a file-based
+// GOPROXY, with GOPRIVATE and a netrc configured as they would be for a
+// private proxy such as Athens.
+func (m *Main) GoProxy(ctx context.Context) error {
+	const (
+		private = "example.com/private/greet"
+		version = "v1.0.0"
+	)
+
+	// lay out the module as a proxy would serve it: list, info, mod, and a
+	// zip of <module>@<version>/...
+	proxy := dag.Container().
+		From("alpine").
+		WithExec([]string{"apk", "add", "--no-cache", "zip"}).
+		WithNewFile("/src/"+private+"@"+version+"/go.mod",
+			"module "+private+"\n\ngo 1.21\n").
+		WithNewFile("/src/"+private+"@"+version+"/greet.go",
+			"package greet\n\nfunc Hello() string { return \"hello from the proxy\" }\n").
+		WithEnvVariable("MODULE", private).
+		WithEnvVariable("VERSION", version).
+		WithWorkdir("/src").
+		WithExec([]string{"sh", "-c", `
+set -e
+dir=/goproxy/$MODULE/@v
+mkdir -p $dir
+echo $VERSION > $dir/list
+echo '{"Version":"'$VERSION'","Time":"2024-01-01T00:00:00Z"}' > $dir/$VERSION.info
+cp $MODULE@$VERSION/go.mod $dir/$VERSION.mod
+zip -qr $dir/$VERSION.zip $MODULE@$VERSION
+`}).
+		Directory("/goproxy")
+
+	src := dag.Directory().
+		WithNewFile("go.mod",
+			"module example.com/consumer\n\ngo 1.21\n\nrequire "+private+" "+version+"\n").
+		WithNewFile("main.go",
+			"package main\n\nimport \""+private+"\"\n\nfunc main() { println(greet.Hello()) }\n")
+
+	goproxy := dag.
+		Go(dagger.GoOpts{
+			// GOPRIVATE implies GONOPROXY; reset it so private modules are
+			// still fetched from the proxy, skipping only the checksum database
+			Base: dag.Go().Base().WithEnvVariable("GONOPROXY", "none"),
+		}).
+		WithGoPrivate([]string{"example.com/private"}).
+		WithGoProxy(dagger.GoWithGoProxyOpts{Dir: proxy}).
+		WithNetrc(dag.SetSecret("netrc", "machine example.com login ci password unused\n"))
+
+	// tidy fills in go.sum from the proxy
+	bin := goproxy.
+		Build(goproxy.Tidy(src), dagger.GoBuildOpts{Static: true}).
+		File("consumer")
+
+	out, err := dag.Container().
+		From("alpine").
+		WithFile("/usr/local/bin/consumer", bin).
+		WithExec([]string{"consumer"}).
+		Stderr(ctx)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(out, "hello from the proxy") {
+		return fmt.Errorf("unexpected output from consumer: %q", out)
+	}
+	return nil
+}
@@ -33,7 +33,8 @@ func (m *Main) Testcontainers(ctx context.Context) error {
 		eg.Go(func() (rerr error) {
 			ctx, span := Tracer().Start(ctx, suite)
 			defer telemetry.End(span, func() error { return rerr })
-			_, err := dag.
+			// test failures don't fail Test itself, so check the result
+			return dag.
 				Go(dagger.GoOpts{
 					Base: dag.Go().Base().With(dag.Testcontainers().Setup),
 				}).
@@ -41,8 +42,7 @@ func (m *Main) Testcontainers(ctx context.Context) error {
 					Subdir:  path.Join("examples", suite),
 					Verbose: true,
 				}).
-				Sync(ctx)
-			return err
+				Check(ctx)
 		})
 	}
 